@@ -0,0 +1,369 @@
+package yandexkassa
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Массовые возвраты, например при инцидентах. Строки берутся из CSV (payment_id, amount, currency, description),
+	у каждой строки свой постоянный ключ идемпотентности (из платежа, суммы и номера повторения такой же строки в файле,
+	поэтому он не меняется, если строки добавить, удалить или переставить), а ход работы пишется в журнал — файл с JSON-записями по строке на событие.
+	При повторном запуске с тем же журналом завершенные строки пропускаются, а прерванные отправляются повторно с тем же ключом,
+	так что Яндекс.Касса вернет уже созданный возврат, а не создаст второй. Ключ действует IdempotenceKeyLifetime:
+	строку, прерванную раньше, BulkRefund не повторяет и переводит в состояние expired — ее нужно проверить вручную.
+*/
+
+//Состояния строки в журнале и отчете
+const (
+	BulkRefundStarted = "started" //Запрос отправлялся, но результат неизвестен. При следующем запуске запрос будет повторен с тем же ключом
+	BulkRefundDone    = "done"    //Возврат создан
+	BulkRefundFailed  = "failed"  //Яндекс.Касса отклонила возврат, повторять его бессмысленно
+	BulkRefundExpired = "expired" //Запрос отправлялся, но ключ идемпотентности истек, и повтор мог бы создать второй возврат. Строку нужно проверить вручную
+)
+
+//Значения по умолчанию для BulkRefund
+const (
+	DefaultBulkConcurrency = 4
+	DefaultBulkAttempts    = 5
+	DefaultBulkKeyPrefix   = "bulk-refund-"
+)
+
+//Сколько Яндекс.Касса помнит ключ идемпотентности
+const IdempotenceKeyLifetime = 24 * time.Hour
+
+//Строка прервана раньше, чем IdempotenceKeyLifetime назад: повтор мог бы создать второй возврат
+var ErrBulkKeyExpired = errors.New("yandexkassa: idempotence key of the interrupted row has expired, check refunds of the payment manually")
+
+//Строка задания на возврат
+type BulkRefundRow struct {
+	Line        int    //Номер строки во входных данных, начиная с 1
+	Occurrence  int    //Сколько раз такая же строка (платеж, сумма, валюта) встречается выше. Заполняется в ReadBulkRefundCSV и Run
+	PaymentID   string //Идентификатор платежа
+	Amount      Amount //Сумма возврата
+	Description string //Основание для возврата. Необязательно
+}
+
+//Результат обработки строки. В этом же виде записи хранятся в журнале
+type BulkRefundResult struct {
+	Key          string `json:"key"`                     //Ключ идемпотентности строки
+	Line         int    `json:"line"`                    //Номер строки во входных данных
+	PaymentID    string `json:"payment_id"`              //Идентификатор платежа
+	Amount       Amount `json:"amount"`                  //Сумма возврата
+	State        string `json:"state"`                   //started, done, failed или expired
+	StartedAt    string `json:"started_at,omitempty"`    //Время первой отправки запроса
+	RefundID     string `json:"refund_id,omitempty"`     //Идентификатор созданного возврата
+	RefundStatus string `json:"refund_status,omitempty"` //Статус возврата на момент создания
+	Error        string `json:"error,omitempty"`         //Текст ошибки для failed, expired и для прерванных строк
+	Skipped      bool   `json:"-"`                       //Строка была завершена при одном из прошлых запусков
+}
+
+type BulkRefundReport struct {
+	Results []BulkRefundResult `json:"results"` //Результаты в порядке строк
+	Done    int                `json:"done"`    //Сколько возвратов создано (включая прошлые запуски)
+	Failed  int                `json:"failed"`  //Сколько строк отклонено
+	Pending int                `json:"pending"` //Сколько строк не удалось завершить — их можно повторить, запустив задание снова
+	Expired int                `json:"expired"` //Сколько строк нельзя повторить из-за истекшего ключа — их нужно проверить вручную
+	Skipped int                `json:"skipped"` //Сколько строк было завершено при прошлых запусках
+}
+
+type BulkRefund struct {
+	Kassa       *Kassa
+	Journal     string                        //Файл журнала. Обязателен: по нему задание продолжается после сбоя
+	Concurrency int                           //Сколько возвратов отправлять одновременно. По умолчанию DefaultBulkConcurrency
+	Attempts    int                           //Сколько раз повторять запрос при сетевых ошибках, 202, 429 и 500. По умолчанию DefaultBulkAttempts
+	KeyPrefix   string                        //Префикс ключей идемпотентности. По умолчанию DefaultBulkKeyPrefix
+	OnResult    func(result BulkRefundResult) //Вызывается после обработки каждой строки. Может вызываться из разных горутин одновременно
+
+	journal sync.Mutex
+}
+
+//ReadBulkRefundCSV читает строки задания из CSV с колонками payment_id, amount, currency, description.
+//Две последние колонки необязательны, валюта по умолчанию — RUB. Первая строка пропускается, если это заголовок (payment_id)
+func ReadBulkRefundCSV(r io.Reader) ([]BulkRefundRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []BulkRefundRow
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "payment_id") {
+			continue
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("yandexkassa: line %d: payment_id and amount are required", line)
+		}
+
+		row := BulkRefundRow{
+			Line:      line,
+			PaymentID: strings.TrimSpace(record[0]),
+			Amount:    Amount{Value: strings.TrimSpace(record[1]), Currency: "RUB"}}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			row.Amount.Currency = strings.TrimSpace(record[2])
+		}
+		if len(record) > 3 {
+			row.Description = record[3]
+		}
+		if _, err = row.Amount.MinorUnits(); err != nil {
+			return nil, fmt.Errorf("yandexkassa: line %d: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+	numberOccurrences(rows)
+	return rows, nil
+}
+
+//numberOccurrences заполняет Occurrence: одинаковые строки (например, два возврата по 3.00 одного платежа)
+//различаются номером повторения, а не номером строки в файле
+func numberOccurrences(rows []BulkRefundRow) {
+	seen := map[string]int{}
+	for i := range rows {
+		identity := rows[i].identity()
+		rows[i].Occurrence = seen[identity]
+		seen[identity]++
+	}
+}
+
+//identity возвращает платеж, сумму и валюту строки. Сумма приводится к виду 3.00, чтобы 3 и 3.00 считались одной суммой
+func (row BulkRefundRow) identity() string {
+	value := row.Amount.Value
+	if units, err := row.Amount.MinorUnits(); err == nil {
+		value = NewAmount(units, "").Value
+	}
+	return row.PaymentID + "|" + value + "|" + row.Amount.Currency
+}
+
+//Key возвращает ключ идемпотентности строки. Он зависит от платежа, суммы и Occurrence, но не от номера строки,
+//поэтому не меняется между запусками, даже если файл отредактировали
+func (b *BulkRefund) Key(row BulkRefundRow) string {
+	prefix := b.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultBulkKeyPrefix
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", row.identity(), row.Occurrence)))
+	return prefix + hex.EncodeToString(sum[:16])
+}
+
+//Run выполняет задание. Ошибка возвращается только при проблемах с журналом или при завершении ctx;
+//ошибки отдельных возвратов попадают в отчет
+func (b *BulkRefund) Run(ctx context.Context, rows []BulkRefundRow) (*BulkRefundReport, error) {
+	if b.Journal == "" {
+		return nil, errors.New("yandexkassa: BulkRefund.Journal is not set")
+	}
+	previous, err := readBulkJournal(b.Journal)
+	if err != nil {
+		return nil, err
+	}
+	rows = append([]BulkRefundRow(nil), rows...)
+	numberOccurrences(rows)
+
+	journal, err := os.OpenFile(b.Journal, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer journal.Close()
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkConcurrency
+	}
+
+	results := make([]BulkRefundResult, len(rows))
+	var (
+		wg       sync.WaitGroup
+		failure  error
+		failOnce sync.Once
+	)
+	queue := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				result, err := b.process(ctx, journal, rows[index], previous)
+				if err != nil {
+					failOnce.Do(func() { failure = err })
+				}
+				results[index] = result
+				if b.OnResult != nil {
+					b.OnResult(result)
+				}
+			}
+		}()
+	}
+	for index := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- index
+	}
+	close(queue)
+	wg.Wait()
+
+	report := &BulkRefundReport{Results: results}
+	for i := range results {
+		if results[i].Key == "" {
+			results[i] = BulkRefundResult{
+				Key: b.Key(rows[i]), Line: rows[i].Line, PaymentID: rows[i].PaymentID, Amount: rows[i].Amount,
+				State: BulkRefundStarted, Error: "not started"}
+		}
+		switch results[i].State {
+		case BulkRefundDone:
+			report.Done++
+		case BulkRefundFailed:
+			report.Failed++
+		case BulkRefundExpired:
+			report.Expired++
+		default:
+			report.Pending++
+		}
+		if results[i].Skipped {
+			report.Skipped++
+		}
+	}
+	if failure == nil {
+		failure = ctx.Err()
+	}
+	return report, failure
+}
+
+func (b *BulkRefund) process(ctx context.Context, journal *os.File, row BulkRefundRow, previous map[string]BulkRefundResult) (BulkRefundResult, error) {
+	key := b.Key(row)
+	result, seen := previous[key]
+	if seen && result.State != BulkRefundStarted {
+		result.Skipped = true
+		result.Line = row.Line
+		return result, nil
+	}
+
+	if seen {
+		//Прошлый запуск прервался после отправки запроса. Повтор с тем же ключом вернет созданный возврат, пока ключ действует
+		if started, err := ParseTime(result.StartedAt); err == nil && !started.IsZero() && time.Since(started) > IdempotenceKeyLifetime {
+			result.Line = row.Line
+			result.State = BulkRefundExpired
+			result.Error = ErrBulkKeyExpired.Error()
+			return result, b.write(journal, result)
+		}
+		result.Line = row.Line
+	} else {
+		result = BulkRefundResult{
+			Key: key, Line: row.Line, PaymentID: row.PaymentID, Amount: row.Amount,
+			State: BulkRefundStarted, StartedAt: FormatTime(time.Now())}
+		if err := b.write(journal, result); err != nil {
+			return result, err
+		}
+	}
+
+	attempts := b.Attempts
+	if attempts <= 0 {
+		attempts = DefaultBulkAttempts
+	}
+	kassa := b.Kassa.WithIdempotenceKey(key)
+	request := RefundRequest{PaymentID: row.PaymentID, Amount: row.Amount, Description: row.Description}
+
+	var (
+		refund *Refund
+		err    error
+	)
+	attempt := 0
+	pollErr := poll(ctx, func() (*Processing, bool, error) {
+		attempt++
+		var processing *Processing
+		refund, processing, err = kassa.CreateRefund(request)
+		if err == nil && processing == nil {
+			return nil, true, nil
+		}
+		if err != nil && !temporaryError(err) {
+			return nil, true, nil
+		}
+		if attempt >= attempts {
+			if processing != nil {
+				err = fmt.Errorf("yandexkassa: refund is still processing after %d attempts", attempts)
+			}
+			return nil, true, nil
+		}
+		return processing, false, nil
+	})
+	if pollErr != nil {
+		result.Error = pollErr.Error()
+		return result, nil
+	}
+	if err != nil && temporaryError(err) {
+		result.Error = err.Error()
+		return result, nil
+	}
+	return b.finish(journal, result, refund, err)
+}
+
+func (b *BulkRefund) finish(journal *os.File, result BulkRefundResult, refund *Refund, err error) (BulkRefundResult, error) {
+	if err != nil {
+		result.State = BulkRefundFailed
+		result.Error = err.Error()
+	} else {
+		result.State = BulkRefundDone
+		result.RefundID = refund.ID
+		result.RefundStatus = refund.Status
+		result.Error = ""
+	}
+	return result, b.write(journal, result)
+}
+
+func (b *BulkRefund) write(journal *os.File, result BulkRefundResult) error {
+	data, err := json.Marshal(&result)
+	if err != nil {
+		return err
+	}
+	b.journal.Lock()
+	defer b.journal.Unlock()
+	if _, err = journal.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return journal.Sync()
+}
+
+//readBulkJournal возвращает последнюю запись журнала для каждого ключа. Недописанная последняя строка пропускается
+func readBulkJournal(path string) (map[string]BulkRefundResult, error) {
+	entries := map[string]BulkRefundResult{}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry BulkRefundResult
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Key == "" {
+			continue
+		}
+		if old, ok := entries[entry.Key]; ok && entry.StartedAt == "" {
+			entry.StartedAt = old.StartedAt
+		}
+		entries[entry.Key] = entry
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,172 @@
+package yandexkassa_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//bulkJob возвращает задание с журналом во временном каталоге и оплаченный платеж на 10.00
+func bulkJob(t *testing.T, srv *kassatest.Server) (*yandexkassa.BulkRefund, *yandexkassa.Payment, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kassa, payment := paidPayment(t, srv)
+	kassa.RefundGuard = nil
+	job := &yandexkassa.BulkRefund{Kassa: kassa, Journal: filepath.Join(dir, "journal.jsonl"), Concurrency: 1}
+	return job, payment, func() { os.RemoveAll(dir) }
+}
+
+//interrupt записывает в журнал строку, запрос по которой был отправлен, но результат не записан
+func interrupt(t *testing.T, job *yandexkassa.BulkRefund, row yandexkassa.BulkRefundRow, startedAt time.Time) {
+	t.Helper()
+	data, err := json.Marshal(yandexkassa.BulkRefundResult{Key: job.Key(row), Line: row.Line, PaymentID: row.PaymentID,
+		Amount: row.Amount, State: yandexkassa.BulkRefundStarted, StartedAt: yandexkassa.FormatTime(startedAt)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(job.Journal, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkResumeSameAmount(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	job, payment, cleanup := bulkJob(t, srv)
+	defer cleanup()
+	rows := []yandexkassa.BulkRefundRow{
+		{Line: 1, PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "3.00", Currency: "RUB"}},
+		{Line: 2, PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "3.00", Currency: "RUB"}, Occurrence: 1}}
+
+	//Первая строка выполнена, вторая прервана до отправки запроса. Возврат первой строки с той же суммой
+	//не должен засчитаться второй
+	if _, _, err := job.Kassa.WithIdempotenceKey(job.Key(rows[0])).CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: rows[0].Amount}); err != nil {
+		t.Fatal(err)
+	}
+	interrupt(t, job, rows[1], time.Now())
+
+	report, err := job.Run(context.Background(), rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Done != 2 || report.Results[0].RefundID == report.Results[1].RefundID {
+		t.Fatalf("got %+v, want two different refunds", report.Results)
+	}
+	if stored, _ := srv.Payment(payment.ID); stored.RefundedAmount.Value != "6.00" {
+		t.Fatalf("refunded %s, want 6.00", stored.RefundedAmount.Value)
+	}
+}
+
+func TestBulkResumeCreatedRefund(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	job, payment, cleanup := bulkJob(t, srv)
+	defer cleanup()
+	rows := []yandexkassa.BulkRefundRow{{Line: 1, PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "4.00", Currency: "RUB"}}}
+
+	first, err := job.Run(context.Background(), rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Возврат создан, но запись о завершении в журнал не попала
+	interrupt(t, job, rows[0], time.Now())
+
+	second, err := job.Run(context.Background(), rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Done != 1 || second.Results[0].RefundID != first.Results[0].RefundID {
+		t.Fatalf("resumed row got refund %s, want %s", second.Results[0].RefundID, first.Results[0].RefundID)
+	}
+	if stored, _ := srv.Payment(payment.ID); stored.RefundedAmount.Value != "4.00" {
+		t.Fatalf("refunded %s, want 4.00", stored.RefundedAmount.Value)
+	}
+}
+
+func TestBulkResumeExpiredKey(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	job, payment, cleanup := bulkJob(t, srv)
+	defer cleanup()
+	rows := []yandexkassa.BulkRefundRow{{Line: 1, PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "4.00", Currency: "RUB"}}}
+	interrupt(t, job, rows[0], time.Now().Add(-yandexkassa.IdempotenceKeyLifetime-time.Hour))
+
+	report, err := job.Run(context.Background(), rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Expired != 1 || report.Pending != 0 || report.Results[0].State != yandexkassa.BulkRefundExpired {
+		t.Fatalf("got %+v, want the row left for a manual check", report.Results[0])
+	}
+	if stored, _ := srv.Payment(payment.ID); stored.RefundedAmount.Value != "" {
+		t.Fatalf("refund was sent with an expired key: refunded %s", stored.RefundedAmount.Value)
+	}
+}
+
+func TestBulkResumeEditedCSV(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	job, payment, cleanup := bulkJob(t, srv)
+	defer cleanup()
+
+	rows, err := yandexkassa.ReadBulkRefundCSV(strings.NewReader("payment_id,amount\n" +
+		payment.ID + ",3.00\n" + payment.ID + ",3.00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := job.Run(context.Background(), rows)
+	if err != nil || first.Done != 2 {
+		t.Fatalf("got %+v, %v", first, err)
+	}
+
+	//В начало файла добавлена строка, и прежние строки сдвинулись. Они не должны создать возвраты повторно
+	edited, err := yandexkassa.ReadBulkRefundCSV(strings.NewReader("payment_id,amount\n" +
+		payment.ID + ",1.00\n" + payment.ID + ",3\n" + payment.ID + ",3.00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := job.Run(context.Background(), edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Done != 3 || second.Skipped != 2 || second.Results[0].Skipped {
+		t.Fatalf("got %+v, want the two old rows skipped", second.Results)
+	}
+	if second.Results[1].Line != 3 || second.Results[1].RefundID != first.Results[0].RefundID {
+		t.Fatalf("got %+v, want the refund of the first run for line 3", second.Results[1])
+	}
+	if stored, _ := srv.Payment(payment.ID); stored.RefundedAmount.Value != "7.00" {
+		t.Fatalf("refunded %s, want 7.00", stored.RefundedAmount.Value)
+	}
+}
+
+func TestBulkRetriesServerErrors(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	job, payment, cleanup := bulkJob(t, srv)
+	defer cleanup()
+	srv.Inject(kassatest.Fault{Method: http.MethodPost, Path: "/refunds", StatusCode: http.StatusInternalServerError})
+
+	report, err := job.Run(context.Background(), []yandexkassa.BulkRefundRow{
+		{Line: 1, PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "4.00", Currency: "RUB"}},
+		{Line: 2, PaymentID: "unknown", Amount: yandexkassa.Amount{Value: "1.00", Currency: "RUB"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Done != 1 || report.Failed != 1 {
+		t.Fatalf("got %+v, want the first row done and the second failed", report.Results)
+	}
+}
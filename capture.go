@@ -0,0 +1,103 @@
+package yandexkassa
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+/*
+	Частичное подтверждение платежа. Если товары переданы пользователю не все, подтверждается только их стоимость,
+	а в чеке остаются только переданные товары. Остаток суммы Яндекс.Касса возвращает пользователю.
+*/
+
+var (
+	ErrCaptureExceedsAuthorized = errors.New("yandexkassa: capture amount exceeds the authorized amount")
+	ErrCaptureCurrency          = errors.New("yandexkassa: capture currency differs from the payment currency")
+	ErrReceiptAmountMismatch    = errors.New("yandexkassa: receipt items total differs from the capture amount")
+)
+
+//NewPartialCapture создает запрос на подтверждение стоимости delivered. Чек копируется из receipt (налогообложение,
+//телефон, почта), но в нем остаются только delivered
+func NewPartialCapture(receipt Receipt, delivered []Item) (*CaptureRequest, error) {
+	amount, err := ItemsAmount(delivered)
+	if err != nil {
+		return nil, err
+	}
+	receipt.Items = append([]Item(nil), delivered...)
+	return &CaptureRequest{Amount: &amount, Receipt: &receipt}, nil
+}
+
+//ItemsAmount возвращает стоимость товаров: сумма цен, умноженных на количество, с округлением до копеек
+func ItemsAmount(items []Item) (Amount, error) {
+	if len(items) == 0 {
+		return Amount{}, errors.New("yandexkassa: no items")
+	}
+	var total int64
+	currency := items[0].Amount.Currency
+	for _, item := range items {
+		if item.Amount.Currency != currency {
+			return Amount{}, fmt.Errorf("yandexkassa: item %q: currency %s differs from %s", item.Description, item.Amount.Currency, currency)
+		}
+		price, err := item.Amount.MinorUnits()
+		if err != nil {
+			return Amount{}, err
+		}
+		quantity, err := strconv.ParseFloat(item.Quantity, 64)
+		if err != nil || quantity <= 0 {
+			return Amount{}, fmt.Errorf("yandexkassa: item %q: invalid quantity %q", item.Description, item.Quantity)
+		}
+		total += int64(math.Round(float64(price) * quantity))
+	}
+	return NewAmount(total, currency), nil
+}
+
+//Validate проверяет запрос перед подтверждением платежа payment: сумма положительна, в валюте платежа
+//и не больше суммы платежа, а товары в чеке и переводы продавцам (если они есть) в сумме дают ровно столько, сколько подтверждается
+func (c *CaptureRequest) Validate(payment *Payment) error {
+	authorized, err := payment.Amount.MinorUnits()
+	if err != nil {
+		return err
+	}
+
+	captured := authorized
+	if c.Amount != nil {
+		if c.Amount.Currency != payment.Amount.Currency {
+			return ErrCaptureCurrency
+		}
+		if captured, err = c.Amount.MinorUnits(); err != nil {
+			return err
+		}
+		if captured <= 0 {
+			return fmt.Errorf("yandexkassa: capture amount %s must be positive", c.Amount.Value)
+		}
+		if captured > authorized {
+			return ErrCaptureExceedsAuthorized
+		}
+	}
+
+	if c.Receipt != nil && len(c.Receipt.Items) > 0 {
+		itemsAmount, err := ItemsAmount(c.Receipt.Items)
+		if err != nil {
+			return err
+		}
+		itemsTotal, _ := itemsAmount.MinorUnits()
+		if itemsAmount.Currency != payment.Amount.Currency || itemsTotal != captured {
+			return ErrReceiptAmountMismatch
+		}
+	}
+	return ValidateTransfers(NewAmount(captured, payment.Amount.Currency), c.Transfers)
+}
+
+//CapturePayment проверяет capture через Validate и подтверждает платеж. Если capture равен nil, платеж подтверждается на всю сумму.
+//payment должен быть в статусе waiting_for_capture: сумма подтверждения сверяется с его Amount
+func (k *Kassa) CapturePayment(payment *Payment, capture *CaptureRequest) (*Payment, *Processing, error) {
+	if capture == nil {
+		capture = &CaptureRequest{}
+	}
+	if err := capture.Validate(payment); err != nil {
+		return nil, nil, err
+	}
+	return k.capture(payment.ID, capture)
+}
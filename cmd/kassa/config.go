@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type config struct {
+	ShopID     int64  `json:"shop_id"`
+	SecretKey  string `json:"secret_key"`
+	OAuthToken string `json:"oauth_token"`
+	BaseURL    string `json:"base_url"`
+}
+
+//loadConfig читает настройки из файла path (или ~/.kassa.json, если он есть) и переменных окружения.
+//Переменные окружения KASSA_SHOP_ID, KASSA_SECRET_KEY, KASSA_OAUTH_TOKEN, KASSA_BASE_URL важнее значений из файла.
+//Если указан OAuth-токен партнера, ShopID и SecretKey не нужны
+func loadConfig(path string) (*config, error) {
+	var c config
+
+	explicit := path != ""
+	if !explicit {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".kassa.json")
+		}
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			if err = json.Unmarshal(data, &c); err != nil {
+				return nil, fmt.Errorf("config %s: %v", path, err)
+			}
+		} else if explicit || !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if value := os.Getenv("KASSA_SHOP_ID"); value != "" {
+		shopID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("KASSA_SHOP_ID: %v", err)
+		}
+		c.ShopID = shopID
+	}
+	if value := os.Getenv("KASSA_SECRET_KEY"); value != "" {
+		c.SecretKey = value
+	}
+	if value := os.Getenv("KASSA_OAUTH_TOKEN"); value != "" {
+		c.OAuthToken = value
+	}
+	if value := os.Getenv("KASSA_BASE_URL"); value != "" {
+		c.BaseURL = value
+	}
+
+	if c.OAuthToken == "" && (c.ShopID == 0 || c.SecretKey == "") {
+		return nil, fmt.Errorf("shop ID and secret key are required: set KASSA_SHOP_ID and KASSA_SECRET_KEY (or KASSA_OAUTH_TOKEN) or use -config")
+	}
+	return &c, nil
+}
+
+//newIdempotenceKey создает случайный ключ идемпотентности в формате UUID v4
+func newIdempotenceKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//setEnv задает переменные настроек утилиты; не указанные в env переменные очищаются
+func setEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{"KASSA_SHOP_ID", "KASSA_SECRET_KEY", "KASSA_OAUTH_TOKEN", "KASSA_BASE_URL"} {
+		t.Setenv(name, env[name])
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kassa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "kassa.json")
+	err = ioutil.WriteFile(file, []byte(`{"shop_id":100500,"secret_key":"file_key","base_url":"https://file.example"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	if err = ioutil.WriteFile(broken, []byte(`{"shop_id":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	//Файл по умолчанию ищется в домашнем каталоге, в тесте его там нет
+	t.Setenv("HOME", dir)
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		want    config
+		wantErr bool
+	}{
+		{name: "file", path: file,
+			want: config{ShopID: 100500, SecretKey: "file_key", BaseURL: "https://file.example"}},
+		{name: "env overrides file", path: file,
+			env:  map[string]string{"KASSA_SHOP_ID": "200", "KASSA_SECRET_KEY": "env_key"},
+			want: config{ShopID: 200, SecretKey: "env_key", BaseURL: "https://file.example"}},
+		{name: "env only",
+			env:  map[string]string{"KASSA_SHOP_ID": "200", "KASSA_SECRET_KEY": "env_key", "KASSA_BASE_URL": "https://env.example"},
+			want: config{ShopID: 200, SecretKey: "env_key", BaseURL: "https://env.example"}},
+		{name: "oauth token without shop",
+			env:  map[string]string{"KASSA_OAUTH_TOKEN": "token"},
+			want: config{OAuthToken: "token"}},
+		{name: "no credentials", wantErr: true},
+		{name: "missing explicit file", path: filepath.Join(dir, "missing.json"),
+			env: map[string]string{"KASSA_SHOP_ID": "200", "KASSA_SECRET_KEY": "env_key"}, wantErr: true},
+		{name: "broken file", path: broken,
+			env: map[string]string{"KASSA_SHOP_ID": "200", "KASSA_SECRET_KEY": "env_key"}, wantErr: true},
+		{name: "bad shop id", path: file, env: map[string]string{"KASSA_SHOP_ID": "shop"}, wantErr: true},
+	}
+	for _, test := range tests {
+		setEnv(t, test.env)
+		c, err := loadConfig(test.path)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", test.name, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *c != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, *c, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+	Утилита kassa — обертка над библиотекой yandexkassa для операций с платежами и возвратами из командной строки.
+
+	Данные магазина берутся из переменных окружения KASSA_SHOP_ID, KASSA_SECRET_KEY (или KASSA_OAUTH_TOKEN) и KASSA_BASE_URL
+	или из файла настроек (по умолчанию ~/.kassa.json, можно указать флагом -config).
+	Для безопасного повтора запроса укажите тот же -idempotence-key, что и в первой попытке.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"yandexkassa"
+)
+
+const usage = `Usage: kassa [global flags] <command> <subcommand> [flags] [args]
+
+Commands:
+  payment create   create a payment
+  payment get      get a payment by ID
+  payment capture  capture a payment in waiting_for_capture
+  payment cancel   cancel a payment
+  payment list     list payments
+  refund create    create a refund
+  refund get       get a refund by ID
+  refund list      list refunds
+  refund bulk      refund payments listed in a CSV file, resumable via a journal
+  payout create    pay out to a bank card, YooMoney wallet or via SBP
+  payout get       get a payout by ID
+  payout list      list payouts
+  payout banks     list banks available for SBP payouts
+  shop check       check credentials and print the shop settings (test mode, payment methods)
+  webhook listen   run a local endpoint that prints received notifications
+  webhook send     post a stored notification to a PaymentNotification URL
+  webhook register subscribe a URL to notifications (requires KASSA_OAUTH_TOKEN)
+  webhook list     list notification subscriptions (requires KASSA_OAUTH_TOKEN)
+  webhook delete   delete a notification subscription (requires KASSA_OAUTH_TOKEN)
+
+Global flags:
+`
+
+//Коды завершения
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitProcessing = 3 //Яндекс.Касса приняла запрос, но еще не обработала его — повторите с тем же ключом идемпотентности
+)
+
+type options struct {
+	config         string
+	output         string
+	idempotenceKey string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var opts options
+	global := flag.NewFlagSet("kassa", flag.ContinueOnError)
+	global.StringVar(&opts.config, "config", "", "path to the config file (default ~/.kassa.json)")
+	global.StringVar(&opts.output, "output", "json", "output format: json or table")
+	global.StringVar(&opts.idempotenceKey, "idempotence-key", "", "Idempotence-Key for POST requests (generated if empty)")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return exitUsage
+	}
+	if global.NArg() < 2 {
+		global.Usage()
+		return exitUsage
+	}
+	command, subcommand, rest := global.Arg(0), global.Arg(1), global.Args()[2:]
+	handler, ok := commands[command+" "+subcommand]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "kassa: unknown command %q\n", command+" "+subcommand)
+		global.Usage()
+		return exitUsage
+	}
+
+	return handler(&opts, rest)
+}
+
+var commands = map[string]func(*options, []string) int{
+	"payment create":   paymentCreate,
+	"payment get":      paymentGet,
+	"payment capture":  paymentCapture,
+	"payment cancel":   paymentCancel,
+	"payment list":     paymentList,
+	"refund create":    refundCreate,
+	"refund get":       refundGet,
+	"refund list":      refundList,
+	"refund bulk":      refundBulk,
+	"payout create":    payoutCreate,
+	"payout get":       payoutGet,
+	"payout list":      payoutList,
+	"payout banks":     payoutBanks,
+	"shop check":       shopCheck,
+	"webhook listen":   webhookListen,
+	"webhook send":     webhookSend,
+	"webhook register": webhookRegister,
+	"webhook list":     webhookList,
+	"webhook delete":   webhookDelete,
+}
+
+//kassa создает клиента из настроек. Для POST-запросов подставляется ключ идемпотентности из флага или новый
+func (opts *options) kassa(post bool) (*yandexkassa.Kassa, error) {
+	config, err := loadConfig(opts.config)
+	if err != nil {
+		return nil, err
+	}
+
+	kassa := &yandexkassa.Kassa{
+		ShopID:     config.ShopID,
+		SecretKey:  config.SecretKey,
+		OAuthToken: config.OAuthToken,
+		BaseURL:    config.BaseURL}
+
+	if post {
+		kassa.IdempotenceKey = opts.idempotenceKey
+		if kassa.IdempotenceKey == "" {
+			if kassa.IdempotenceKey, err = newIdempotenceKey(); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Idempotence-Key: %s\n", kassa.IdempotenceKey)
+	}
+	return kassa, nil
+}
+
+//finish печатает результат запроса и возвращает код завершения
+func (opts *options) finish(result interface{}, processing *yandexkassa.Processing, err error) int {
+	if err != nil {
+		if yandexError, ok := yandexkassa.IsYandexError(err); ok {
+			fmt.Fprintln(os.Stderr, "kassa: yandex error:", yandexError)
+		} else {
+			fmt.Fprintln(os.Stderr, "kassa:", err)
+		}
+		return exitError
+	}
+	if processing != nil {
+		fmt.Fprintf(os.Stderr, "kassa: request is processing (%s), retry after %d ms with the same idempotence key\n",
+			processing.Description, processing.RetryAfter)
+		return exitProcessing
+	}
+
+	if err = printResult(os.Stdout, opts.output, result); err != nil {
+		fmt.Fprintln(os.Stderr, "kassa:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+//parseFlags разбирает флаги подкоманды и проверяет количество позиционных аргументов.
+//Глобальные флаги -output и -idempotence-key можно указать и после подкоманды
+func (opts *options) parseFlags(flags *flag.FlagSet, args []string, nargs int, argsUsage string) bool {
+	flags.StringVar(&opts.output, "output", opts.output, "output format: json or table")
+	flags.StringVar(&opts.idempotenceKey, "idempotence-key", opts.idempotenceKey, "Idempotence-Key for POST requests (generated if empty)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: kassa %s [flags] %s\n", flags.Name(), argsUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if flags.NArg() != nargs {
+		flags.Usage()
+		return false
+	}
+	if opts.output != "json" && opts.output != "table" {
+		fmt.Fprintf(os.Stderr, "kassa: unknown output format %q\n", opts.output)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	//Сообщения об ошибках флагов в тесте не нужны
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	tests := []struct {
+		name           string
+		global         options
+		args           []string
+		nargs          int
+		ok             bool
+		output         string
+		idempotenceKey string
+		amount         string
+	}{
+		{name: "defaults", global: options{output: "json"}, args: []string{"p1"}, nargs: 1, ok: true, output: "json"},
+		{name: "global flags are kept", global: options{output: "table", idempotenceKey: "k1"}, args: []string{"p1"}, nargs: 1,
+			ok: true, output: "table", idempotenceKey: "k1"},
+		{name: "global flags after the subcommand", global: options{output: "json"},
+			args: []string{"-output", "table", "-idempotence-key", "k2", "p1"}, nargs: 1, ok: true, output: "table", idempotenceKey: "k2"},
+		{name: "subcommand flag", global: options{output: "json"}, args: []string{"-amount", "10.00"}, ok: true, output: "json", amount: "10.00"},
+		{name: "missing argument", global: options{output: "json"}, nargs: 1},
+		{name: "extra argument", global: options{output: "json"}, args: []string{"p1", "p2"}, nargs: 1},
+		{name: "unknown output", global: options{output: "json"}, args: []string{"-output", "xml"}},
+		{name: "unknown flag", global: options{output: "json"}, args: []string{"-unknown"}},
+	}
+	for _, test := range tests {
+		opts := test.global
+		flags := flag.NewFlagSet("payment capture", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		amount := flags.String("amount", "", "amount")
+		ok := opts.parseFlags(flags, test.args, test.nargs, "<payment-id>")
+		if ok != test.ok {
+			t.Errorf("%s: parseFlags returned %t, want %t", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if opts.output != test.output || opts.idempotenceKey != test.idempotenceKey || *amount != test.amount {
+			t.Errorf("%s: got output %q, key %q, amount %q", test.name, opts.output, opts.idempotenceKey, *amount)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"yandexkassa"
+)
+
+//printResult печатает объект в формате json или table
+func printResult(w io.Writer, format string, result interface{}) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch v := result.(type) {
+	case *yandexkassa.Payment:
+		paymentTable(tw, []yandexkassa.Payment{*v})
+	case *yandexkassa.PaymentList:
+		paymentTable(tw, v.Items)
+		if v.NextCursor != "" {
+			defer fmt.Fprintf(w, "next cursor: %s\n", v.NextCursor)
+		}
+	case *yandexkassa.Refund:
+		refundTable(tw, []yandexkassa.Refund{*v})
+	case *yandexkassa.RefundList:
+		refundTable(tw, v.Items)
+		if v.NextCursor != "" {
+			defer fmt.Fprintf(w, "next cursor: %s\n", v.NextCursor)
+		}
+	case *yandexkassa.Payout:
+		payoutTable(tw, []yandexkassa.Payout{*v})
+	case *yandexkassa.PayoutList:
+		payoutTable(tw, v.Items)
+		if v.NextCursor != "" {
+			defer fmt.Fprintf(w, "next cursor: %s\n", v.NextCursor)
+		}
+	case []yandexkassa.SbpBank:
+		fmt.Fprintln(tw, "BANK ID\tBIC\tNAME")
+		for _, bank := range v {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", bank.BankID, bank.BIC, bank.Name)
+		}
+	case *yandexkassa.WebhookList:
+		fmt.Fprintln(tw, "ID\tEVENT\tURL")
+		for _, webhook := range v.Items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", webhook.ID, webhook.Event, webhook.URL)
+		}
+	case *yandexkassa.Account:
+		fiscalization := false
+		if v.Fiscalization != nil {
+			fiscalization = v.Fiscalization.Enabled
+		}
+		fmt.Fprintln(tw, "ACCOUNT\tSTATUS\tTEST\tFISCALIZATION\tPAYMENT METHODS")
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\n", v.AccountID, v.Status, v.Test, fiscalization, strings.Join(v.PaymentMethods, ","))
+	case *yandexkassa.BulkRefundReport:
+		bulkTable(tw, v.Results)
+		defer fmt.Fprintf(w, "done: %d, failed: %d, pending: %d, skipped: %d\n", v.Done, v.Failed, v.Pending, v.Skipped)
+	default:
+		return fmt.Errorf("table output is not supported for %T", result)
+	}
+	return tw.Flush()
+}
+
+func paymentTable(w io.Writer, payments []yandexkassa.Payment) {
+	fmt.Fprintln(w, "ID\tSTATUS\tAMOUNT\tREFUNDED\tMETHOD\tCREATED\tDESCRIPTION")
+	for _, p := range payments {
+		method := ""
+		if p.PaymentMethod != nil {
+			method = p.PaymentMethod.Type()
+		}
+		status := p.Status
+		if p.CancellationDetails != nil {
+			status += " (" + string(p.CancellationDetails.Reason) + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.ID, status, formatAmount(p.Amount),
+			formatAmount(p.RefundedAmount), method, p.CreatedAt, p.Description)
+	}
+}
+
+func refundTable(w io.Writer, refunds []yandexkassa.Refund) {
+	fmt.Fprintln(w, "ID\tPAYMENT\tSTATUS\tAMOUNT\tCREATED\tDESCRIPTION")
+	for _, r := range refunds {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.PaymentID, r.Status, formatAmount(r.Amount),
+			r.CreatedAt, r.Description)
+	}
+}
+
+func payoutTable(w io.Writer, payouts []yandexkassa.Payout) {
+	fmt.Fprintln(w, "ID\tSTATUS\tAMOUNT\tDESTINATION\tCREATED\tDESCRIPTION")
+	for _, p := range payouts {
+		status := p.Status
+		if p.CancellationDetails != nil {
+			status += " (" + string(p.CancellationDetails.Reason) + ")"
+		}
+		destination := p.PayoutDestination.Type
+		switch {
+		case p.PayoutDestination.Card != nil:
+			destination += " *" + p.PayoutDestination.Card.Last4
+		case p.PayoutDestination.AccountNumber != "":
+			destination += " " + p.PayoutDestination.AccountNumber
+		case p.PayoutDestination.Phone != "":
+			destination += " " + p.PayoutDestination.Phone
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.ID, status, formatAmount(p.Amount), destination, p.CreatedAt, p.Description)
+	}
+}
+
+func bulkTable(w io.Writer, results []yandexkassa.BulkRefundResult) {
+	fmt.Fprintln(w, "LINE\tPAYMENT\tAMOUNT\tSTATE\tREFUND\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Line, r.PaymentID, formatAmount(r.Amount), r.State, r.RefundID, r.Error)
+	}
+}
+
+func formatAmount(amount yandexkassa.Amount) string {
+	if amount.Value == "" {
+		return "-"
+	}
+	return amount.Value + " " + amount.Currency
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"yandexkassa"
+)
+
+func paymentCreate(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payment create", flag.ContinueOnError)
+	data := flags.String("data", "", "file with a PaymentRequest in JSON (- for stdin); other flags override its fields")
+	amount := flags.String("amount", "", "payment amount, e.g. 100.00")
+	currency := flags.String("currency", "RUB", "currency code (ISO-4217)")
+	description := flags.String("description", "", "payment description")
+	capture := flags.Bool("capture", false, "capture the payment automatically")
+	returnURL := flags.String("return-url", "", "return URL for the redirect confirmation")
+	methodID := flags.String("payment-method-id", "", "ID of a saved payment method")
+	savePaymentMethod := flags.Bool("save-payment-method", false, "save the payment method for recurring payments")
+	sbp := flags.Bool("sbp", false, "pay via SBP with a QR code; the QR payload is printed to stderr")
+	metadata := keyValues{}
+	flags.Var(metadata, "metadata", "metadata key=value (repeatable)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	var request yandexkassa.PaymentRequest
+	if *data != "" {
+		if err := readJSON(*data, &request); err != nil {
+			fmt.Fprintln(os.Stderr, "kassa:", err)
+			return exitUsage
+		}
+	}
+	if *amount != "" {
+		request.Amount = yandexkassa.Amount{Value: *amount, Currency: *currency}
+	}
+	if *description != "" {
+		request.Description = *description
+	}
+	if *capture {
+		request.Capture = true
+	}
+	if *returnURL != "" {
+		request.Confirmation = yandexkassa.Confirmation{Type: yandexkassa.ConfirmationRedirect, ReturnUrl: *returnURL}
+	}
+	if *methodID != "" {
+		request.PaymentMethodId = *methodID
+	}
+	if *savePaymentMethod {
+		request.SavePaymentMethod = true
+	}
+	if *sbp {
+		request.PaymentMethodData = yandexkassa.SbpData{}
+		request.Confirmation = yandexkassa.Confirmation{Type: yandexkassa.ConfirmationQR}
+	}
+	if len(metadata) > 0 {
+		if request.Metadata == nil {
+			request.Metadata = map[string]interface{}{}
+		}
+		for key, value := range metadata {
+			request.Metadata[key] = value
+		}
+	}
+	if request.Amount.Value == "" {
+		fmt.Fprintln(os.Stderr, "kassa: -amount or -data with an amount is required")
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payment, processing, err := kassa.CreatePayment(&request)
+	if err == nil && processing == nil {
+		if qr, qrErr := payment.QRData(); qrErr == nil {
+			fmt.Fprintln(os.Stderr, "QR:", qr)
+		}
+	}
+	return opts.finish(payment, processing, err)
+}
+
+func paymentGet(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payment get", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 1, "<payment-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payment, processing, err := kassa.PaymentInfo(flags.Arg(0))
+	return opts.finish(payment, processing, err)
+}
+
+func paymentCapture(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payment capture", flag.ContinueOnError)
+	amount := flags.String("amount", "", "amount to capture (default: the whole authorized amount)")
+	receipt := flags.String("receipt", "", "file with the adjusted receipt JSON, - for stdin")
+	if !opts.parseFlags(flags, args, 1, "<payment-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payment, processing, err := kassa.PaymentInfo(flags.Arg(0))
+	if err != nil || processing != nil {
+		return opts.finish(nil, processing, err)
+	}
+
+	var request yandexkassa.CaptureRequest
+	if *amount != "" {
+		request.Amount = &yandexkassa.Amount{Value: *amount, Currency: payment.Amount.Currency}
+	}
+	if *receipt != "" {
+		request.Receipt = &yandexkassa.Receipt{}
+		if err := readJSON(*receipt, request.Receipt); err != nil {
+			return opts.finish(nil, nil, err)
+		}
+	}
+	payment, processing, err = kassa.CapturePayment(payment, &request)
+	return opts.finish(payment, processing, err)
+}
+
+func paymentCancel(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payment cancel", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 1, "<payment-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payment, processing, err := kassa.PaymentCancel(flags.Arg(0))
+	return opts.finish(payment, processing, err)
+}
+
+func paymentList(opts *options, args []string) int {
+	var filter yandexkassa.PaymentListFilter
+	flags := flag.NewFlagSet("payment list", flag.ContinueOnError)
+	flags.StringVar(&filter.Status, "status", "", "payment status")
+	flags.StringVar(&filter.PaymentMethod, "payment-method", "", "payment method type, e.g. bank_card")
+	flags.IntVar(&filter.Limit, "limit", 0, "number of payments, 1-100")
+	flags.StringVar(&filter.Cursor, "cursor", "", "cursor from the previous page")
+	flags.Var((*timeValue)(&filter.CreatedAt.Gte), "created-gte", "created at or after (ISO 8601)")
+	flags.Var((*timeValue)(&filter.CreatedAt.Lt), "created-lt", "created before (ISO 8601)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	list, processing, err := kassa.ListPayments(&filter)
+	return opts.finish(list, processing, err)
+}
+
+//readJSON читает JSON из файла или из stdin, если path равен -
+func readJSON(path string, v interface{}) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Флаг вида -metadata key=value, который можно указать несколько раз
+type keyValues map[string]string
+
+func (kv keyValues) String() string {
+	var pairs []string
+	for key, value := range kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (kv keyValues) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	kv[parts[0]] = parts[1]
+	return nil
+}
+
+//Флаг со временем в формате ISO 8601
+type timeValue time.Time
+
+func (t *timeValue) String() string {
+	if t == nil || time.Time(*t).IsZero() {
+		return ""
+	}
+	return yandexkassa.FormatTime(time.Time(*t))
+}
+
+func (t *timeValue) Set(value string) error {
+	parsed, err := yandexkassa.ParseTime(value)
+	if err != nil {
+		return err
+	}
+	*t = timeValue(parsed)
+	return nil
+}
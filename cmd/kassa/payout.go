@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"yandexkassa"
+)
+
+func payoutCreate(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payout create", flag.ContinueOnError)
+	data := flags.String("data", "", "file with a PayoutRequest in JSON (- for stdin); other flags override its fields")
+	amount := flags.String("amount", "", "payout amount, e.g. 100.00")
+	currency := flags.String("currency", "RUB", "currency code (ISO-4217)")
+	description := flags.String("description", "", "payout description")
+	card := flags.String("card", "", "bank card number of the recipient")
+	wallet := flags.String("yoo-money", "", "YooMoney wallet number of the recipient")
+	phone := flags.String("sbp-phone", "", "phone number of the recipient for an SBP payout")
+	bank := flags.String("sbp-bank", "", "bank ID of the recipient for an SBP payout (see payout banks)")
+	deal := flags.String("deal-id", "", "ID of the Safe Deal the payout belongs to")
+	selfEmployed := flags.String("self-employed-id", "", "ID of the self-employed recipient")
+	service := flags.String("service-name", "", "service name for the self-employed receipt")
+	metadata := keyValues{}
+	flags.Var(metadata, "metadata", "metadata key=value (repeatable)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	var request yandexkassa.PayoutRequest
+	if *data != "" {
+		if err := readJSON(*data, &request); err != nil {
+			fmt.Fprintln(os.Stderr, "kassa:", err)
+			return exitUsage
+		}
+	}
+	if *amount != "" {
+		request.Amount = yandexkassa.Amount{Value: *amount, Currency: *currency}
+	}
+	if *description != "" {
+		request.Description = *description
+	}
+	switch {
+	case *card != "":
+		request.PayoutDestinationData = &yandexkassa.PayoutDestination{
+			Type: yandexkassa.PayoutDestinationBankCard,
+			Card: &yandexkassa.PayoutCard{Number: *card}}
+	case *wallet != "":
+		request.PayoutDestinationData = &yandexkassa.PayoutDestination{
+			Type:          yandexkassa.PayoutDestinationYooMoney,
+			AccountNumber: *wallet}
+	case *phone != "":
+		request.PayoutDestinationData = &yandexkassa.PayoutDestination{
+			Type:   yandexkassa.PayoutDestinationSbp,
+			Phone:  *phone,
+			BankID: *bank}
+	}
+	if *deal != "" {
+		request.Deal = &yandexkassa.PayoutDeal{ID: *deal}
+	}
+	if *selfEmployed != "" {
+		request.SelfEmployed = &yandexkassa.PayoutSelfEmployed{ID: *selfEmployed}
+	}
+	if *service != "" {
+		request.ReceiptData = &yandexkassa.PayoutReceiptData{ServiceName: *service}
+	}
+	if len(metadata) > 0 {
+		if request.Metadata == nil {
+			request.Metadata = map[string]interface{}{}
+		}
+		for key, value := range metadata {
+			request.Metadata[key] = value
+		}
+	}
+	if request.Amount.Value == "" || (request.PayoutDestinationData == nil && request.PayoutToken == "") {
+		fmt.Fprintln(os.Stderr, "kassa: -amount and one of -card, -yoo-money or -sbp-phone are required")
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payout, processing, err := kassa.CreatePayout(&request)
+	return opts.finish(payout, processing, err)
+}
+
+func payoutGet(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payout get", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 1, "<payout-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	payout, processing, err := kassa.PayoutInfo(flags.Arg(0))
+	return opts.finish(payout, processing, err)
+}
+
+func payoutList(opts *options, args []string) int {
+	var filter yandexkassa.PayoutListFilter
+	flags := flag.NewFlagSet("payout list", flag.ContinueOnError)
+	flags.StringVar(&filter.Status, "status", "", "payout status")
+	flags.StringVar(&filter.DestinationType, "destination", "", "destination type: bank_card, yoo_money or sbp")
+	flags.IntVar(&filter.Limit, "limit", 0, "number of payouts, 1-100")
+	flags.StringVar(&filter.Cursor, "cursor", "", "cursor from the previous page")
+	flags.Var((*timeValue)(&filter.CreatedAt.Gte), "created-gte", "created at or after (ISO 8601)")
+	flags.Var((*timeValue)(&filter.CreatedAt.Lt), "created-lt", "created before (ISO 8601)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	list, processing, err := kassa.ListPayouts(&filter)
+	return opts.finish(list, processing, err)
+}
+
+func payoutBanks(opts *options, args []string) int {
+	flags := flag.NewFlagSet("payout banks", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	banks, processing, err := kassa.SbpBanks()
+	return opts.finish(banks, processing, err)
+}
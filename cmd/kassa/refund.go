@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"yandexkassa"
+)
+
+func refundCreate(opts *options, args []string) int {
+	var request yandexkassa.RefundRequest
+	flags := flag.NewFlagSet("refund create", flag.ContinueOnError)
+	flags.StringVar(&request.PaymentID, "payment-id", "", "ID of the payment to refund")
+	flags.StringVar(&request.Amount.Value, "amount", "", "refund amount, e.g. 100.00")
+	flags.StringVar(&request.Amount.Currency, "currency", "RUB", "currency code (ISO-4217)")
+	flags.StringVar(&request.Description, "description", "", "reason for the refund")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+	if request.PaymentID == "" || request.Amount.Value == "" {
+		fmt.Fprintln(os.Stderr, "kassa: -payment-id and -amount are required")
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	refund, processing, err := kassa.CreateRefund(request)
+	return opts.finish(refund, processing, err)
+}
+
+func refundGet(opts *options, args []string) int {
+	flags := flag.NewFlagSet("refund get", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 1, "<refund-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	refund, processing, err := kassa.RefundInfo(flags.Arg(0))
+	return opts.finish(refund, processing, err)
+}
+
+func refundList(opts *options, args []string) int {
+	var filter yandexkassa.RefundListFilter
+	flags := flag.NewFlagSet("refund list", flag.ContinueOnError)
+	flags.StringVar(&filter.PaymentID, "payment-id", "", "payment ID")
+	flags.StringVar(&filter.Status, "status", "", "refund status")
+	flags.IntVar(&filter.Limit, "limit", 0, "number of refunds, 1-100")
+	flags.StringVar(&filter.Cursor, "cursor", "", "cursor from the previous page")
+	flags.Var((*timeValue)(&filter.CreatedAt.Gte), "created-gte", "created at or after (ISO 8601)")
+	flags.Var((*timeValue)(&filter.CreatedAt.Lt), "created-lt", "created before (ISO 8601)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	list, processing, err := kassa.ListRefunds(&filter)
+	return opts.finish(list, processing, err)
+}
+
+func refundBulk(opts *options, args []string) int {
+	flags := flag.NewFlagSet("refund bulk", flag.ContinueOnError)
+	journal := flags.String("journal", "", "progress journal; rerun with the same journal to resume (default <file>.journal)")
+	concurrency := flags.Int("concurrency", yandexkassa.DefaultBulkConcurrency, "number of refunds sent at once")
+	keyPrefix := flags.String("key-prefix", yandexkassa.DefaultBulkKeyPrefix, "prefix of per-row idempotence keys")
+	check := flags.Bool("check", false, "check the refundable balance of each payment before refunding")
+	if !opts.parseFlags(flags, args, 1, "<file.csv>") {
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	if *journal == "" {
+		if path == "-" {
+			fmt.Fprintln(os.Stderr, "kassa: -journal is required when reading from stdin")
+			return exitUsage
+		}
+		*journal = path + ".journal"
+	}
+
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return opts.finish(nil, nil, err)
+		}
+		defer file.Close()
+		input = file
+	}
+	rows, err := yandexkassa.ReadBulkRefundCSV(input)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	if *check {
+		kassa.RefundGuard = &yandexkassa.RefundGuard{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		fmt.Fprintln(os.Stderr, "kassa: interrupted, waiting for requests in flight")
+		cancel()
+	}()
+
+	bulk := &yandexkassa.BulkRefund{
+		Kassa:       kassa,
+		Journal:     *journal,
+		Concurrency: *concurrency,
+		KeyPrefix:   *keyPrefix,
+		OnResult: func(result yandexkassa.BulkRefundResult) {
+			fmt.Fprintf(os.Stderr, "line %d: %s %s %s\n", result.Line, result.PaymentID, result.State, result.Error)
+		}}
+	report, err := bulk.Run(ctx, rows)
+	if report == nil {
+		return opts.finish(nil, nil, err)
+	}
+	if code := opts.finish(report, nil, nil); code != exitOK {
+		return code
+	}
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	if report.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "kassa: %d failed\n", report.Failed)
+	}
+	if report.Expired > 0 {
+		fmt.Fprintf(os.Stderr, "kassa: %d rows have expired idempotence keys; check refunds of their payments manually, a rerun skips them\n",
+			report.Expired)
+	}
+	if report.Pending > 0 {
+		fmt.Fprintf(os.Stderr, "kassa: %d pending; rerun with -journal %s to retry them\n", report.Pending, *journal)
+	}
+	if report.Failed > 0 || report.Pending > 0 || report.Expired > 0 {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+)
+
+func shopCheck(opts *options, args []string) int {
+	flags := flag.NewFlagSet("shop check", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 10*time.Second, "time limit for the request")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	account, err := kassa.HealthCheck(ctx)
+	return opts.finish(account, nil, err)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"yandexkassa"
+)
+
+func webhookListen(opts *options, args []string) int {
+	flags := flag.NewFlagSet("webhook listen", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	path := flags.String("path", "/", "URL path for notifications")
+	saveDir := flags.String("save-dir", "", "directory to save received notifications to (for webhook send)")
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(*path, func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var notification yandexkassa.Notification
+		if err = json.Unmarshal(body, &notification); err != nil {
+			fmt.Fprintf(os.Stderr, "kassa: invalid notification from %s: %v\n", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format(time.RFC3339), notification.Event)
+		if err = printNotification(opts.output, &notification); err != nil {
+			fmt.Fprintln(os.Stderr, "kassa:", err)
+		}
+
+		if *saveDir != "" {
+			name := notificationFile(time.Now(), notification.Event)
+			if err = ioutil.WriteFile(filepath.Join(*saveDir, name), body, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, "kassa:", err)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	fmt.Fprintf(os.Stderr, "Listening for notifications on http://%s%s\n", *addr, *path)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Fprintln(os.Stderr, "kassa:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+//notificationFile возвращает имя файла для сохранения уведомления. Событие приходит из сети,
+//поэтому в имени от него остаются только символы [a-z_.] и оно не может указать на другой каталог
+func notificationFile(received time.Time, event string) string {
+	event = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r == '_' || r == '.' {
+			return r
+		}
+		return -1
+	}, event)
+	if event == "" {
+		event = "unknown"
+	}
+	return fmt.Sprintf("%s-%s.json", received.Format("20060102T150405.000"), event)
+}
+
+func printNotification(format string, notification *yandexkassa.Notification) error {
+	var object interface{}
+	var err error
+	switch {
+	case strings.HasPrefix(notification.Event, "payment."):
+		object, err = notification.Payment()
+	case strings.HasPrefix(notification.Event, "refund."):
+		object, err = notification.Refund()
+	default:
+		object = notification
+	}
+	if err != nil {
+		return err
+	}
+	return printResult(os.Stdout, format, object)
+}
+
+func webhookSend(opts *options, args []string) int {
+	flags := flag.NewFlagSet("webhook send", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:8080/", "URL of the PaymentNotification handler")
+	event := flags.String("event", "", "event for a file with a bare payment or refund (default: derived from its status)")
+	if !opts.parseFlags(flags, args, 1, "<file>") {
+		return exitUsage
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	body, err := notificationBody(data, *event)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+
+	resp, err := http.Post(*url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	defer resp.Body.Close()
+	response, _ := ioutil.ReadAll(resp.Body)
+
+	fmt.Fprintln(os.Stderr, resp.Status)
+	if len(response) > 0 {
+		os.Stdout.Write(response)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return exitError
+	}
+	return exitOK
+}
+
+func webhookRegister(opts *options, args []string) int {
+	flags := flag.NewFlagSet("webhook register", flag.ContinueOnError)
+	events := flags.String("events", strings.Join([]string{yandexkassa.EventPaymentWaitingForCapture, yandexkassa.EventPaymentSucceeded,
+		yandexkassa.EventPaymentCanceled, yandexkassa.EventRefundSucceeded}, ","), "comma-separated events to subscribe to")
+	if !opts.parseFlags(flags, args, 1, "<url>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(true)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	webhooks, processing, err := kassa.RegisterWebhooks(flags.Arg(0), strings.Split(*events, ",")...)
+	return opts.finish(&yandexkassa.WebhookList{Type: "list", Items: webhooks}, processing, err)
+}
+
+func webhookList(opts *options, args []string) int {
+	flags := flag.NewFlagSet("webhook list", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 0, "") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	list, processing, err := kassa.ListWebhooks()
+	return opts.finish(list, processing, err)
+}
+
+func webhookDelete(opts *options, args []string) int {
+	flags := flag.NewFlagSet("webhook delete", flag.ContinueOnError)
+	if !opts.parseFlags(flags, args, 1, "<webhook-id>") {
+		return exitUsage
+	}
+
+	kassa, err := opts.kassa(false)
+	if err != nil {
+		return opts.finish(nil, nil, err)
+	}
+	processing, err := kassa.DeleteWebhook(flags.Arg(0))
+	if err == nil && processing == nil {
+		fmt.Fprintln(os.Stderr, "deleted", flags.Arg(0))
+		return exitOK
+	}
+	return opts.finish(nil, processing, err)
+}
+
+//notificationBody возвращает тело уведомления из файла. Файл может содержать готовое уведомление
+//(например, сохраненное командой webhook listen) или платеж/возврат без обертки
+func notificationBody(data []byte, event string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var notification *yandexkassa.Notification
+	if string(fields["type"]) == `"`+yandexkassa.NotificationType+`"` {
+		if err := json.Unmarshal(data, &notification); err != nil {
+			return nil, err
+		}
+		if event != "" {
+			notification.Event = event
+		}
+		return json.Marshal(notification)
+	}
+
+	if event == "" {
+		var object struct {
+			Status    string `json:"status"`
+			PaymentID string `json:"payment_id"`
+		}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+		if object.Status == "" {
+			return nil, fmt.Errorf("cannot derive event: object has no status, use -event")
+		}
+		event = "payment." + object.Status
+		if object.PaymentID != "" {
+			event = "refund." + object.Status
+		}
+	}
+	return json.Marshal(&yandexkassa.Notification{
+		Type:   yandexkassa.NotificationType,
+		Event:  event,
+		Object: json.RawMessage(data)})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yandexkassa"
+)
+
+func TestNotificationFile(t *testing.T) {
+	received := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		event string
+		want  string
+	}{
+		{"payment.succeeded", "20200102T030405.000-payment.succeeded.json"},
+		{"../../x", "20200102T030405.000-....x.json"},
+		{"/etc/passwd", "20200102T030405.000-etcpasswd.json"},
+		{`..\..\x`, "20200102T030405.000-....x.json"},
+		{"", "20200102T030405.000-unknown.json"},
+	}
+	for _, test := range tests {
+		name := notificationFile(received, test.event)
+		if name != test.want {
+			t.Errorf("notificationFile(%q) = %q, want %q", test.event, name, test.want)
+		}
+		if filepath.Base(name) != name {
+			t.Errorf("notificationFile(%q) = %q leaves the directory", test.event, name)
+		}
+	}
+}
+
+func TestNotificationBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		event string
+		want  string //Событие в уведомлении или пустая строка, если ожидается ошибка
+	}{
+		{"payment", `{"id":"p1","status":"succeeded"}`, "", yandexkassa.EventPaymentSucceeded},
+		{"waiting payment", `{"id":"p1","status":"waiting_for_capture"}`, "", yandexkassa.EventPaymentWaitingForCapture},
+		{"refund", `{"id":"r1","payment_id":"p1","status":"succeeded"}`, "", yandexkassa.EventRefundSucceeded},
+		{"event flag", `{"id":"p1","status":"succeeded"}`, yandexkassa.EventPaymentCanceled, yandexkassa.EventPaymentCanceled},
+		{"saved notification", `{"type":"notification","event":"payment.succeeded","object":{"id":"p1"}}`, "", yandexkassa.EventPaymentSucceeded},
+		{"saved notification with event flag", `{"type":"notification","event":"payment.succeeded","object":{"id":"p1"}}`, yandexkassa.EventPaymentCanceled, yandexkassa.EventPaymentCanceled},
+		{"no status", `{"id":"p1"}`, "", ""},
+		{"not JSON", `payment`, "", ""},
+	}
+	for _, test := range tests {
+		body, err := notificationBody([]byte(test.data), test.event)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.name, body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var notification yandexkassa.Notification
+		if err = json.Unmarshal(body, &notification); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if notification.Type != yandexkassa.NotificationType || notification.Event != test.want {
+			t.Errorf("%s: got type %q, event %q; want event %q", test.name, notification.Type, notification.Event, test.want)
+		}
+		var object struct {
+			ID string `json:"id"`
+		}
+		if err = json.Unmarshal(notification.Object, &object); err != nil || object.ID == "" {
+			t.Errorf("%s: object %s is lost", test.name, notification.Object)
+		}
+	}
+}
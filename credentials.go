@@ -0,0 +1,203 @@
+package yandexkassa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	Данные авторизации из внешних источников. Если у Kassa указан Credentials, он опрашивается перед каждым запросом,
+	поэтому секретный ключ можно сменить без перезапуска сервиса. Чтобы смена прошла без простоя, провайдер какое-то время
+	отдает и предыдущий ключ (Credentials.Previous): если Яндекс.Касса отвечает 401 на текущий, запрос повторяется с предыдущим.
+	Так ключ можно выпустить в личном кабинете и положить в файл в любом порядке.
+*/
+
+//Данные авторизации не заданы
+var ErrNoCredentials = errors.New("yandexkassa: credentials are not set")
+
+//Время, в течение которого FileCredentials отдает предыдущий ключ после смены, и частота проверки файла по умолчанию
+const (
+	DefaultCredentialsOverlap       = 24 * time.Hour
+	DefaultCredentialsCheckInterval = 10 * time.Second
+)
+
+//Данные, которыми авторизуются запросы к API. Если указан OAuthToken, используется он, иначе ShopID и SecretKey
+type Credentials struct {
+	ShopID     int64        `json:"shop_id"`               //Идентификатор магазина
+	SecretKey  string       `json:"secret_key"`            //Секретный ключ магазина
+	OAuthToken string       `json:"oauth_token,omitempty"` //OAuth-токен партнера
+	Previous   *Credentials `json:"-"`                     //Предыдущие данные на время смены ключа. Если на текущие пришел ответ 401, запрос повторяется с ними
+}
+
+//Источник данных авторизации. Credentials вызывается перед каждым запросом, в том числе из разных горутин
+type CredentialsProvider interface {
+	Credentials() (*Credentials, error)
+}
+
+func (c *Credentials) valid() bool {
+	return c.OAuthToken != "" || (c.ShopID != 0 && c.SecretKey != "")
+}
+
+func (c *Credentials) apply(req *http.Request) {
+	if c.OAuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.OAuthToken)
+		return
+	}
+	req.SetBasicAuth(strconv.FormatInt(c.ShopID, 10), c.SecretKey)
+}
+
+//Данные из переменных окружения. Переменные читаются при каждом запросе; пустое имя переменной заменяется именем по умолчанию
+type EnvCredentials struct {
+	ShopIDVar            string //По умолчанию KASSA_SHOP_ID
+	SecretKeyVar         string //По умолчанию KASSA_SECRET_KEY
+	OAuthTokenVar        string //По умолчанию KASSA_OAUTH_TOKEN
+	PreviousSecretKeyVar string //Предыдущий ключ на время смены, по умолчанию KASSA_PREVIOUS_SECRET_KEY
+}
+
+func (e EnvCredentials) Credentials() (*Credentials, error) {
+	credentials := &Credentials{
+		SecretKey:  os.Getenv(envName(e.SecretKeyVar, "KASSA_SECRET_KEY")),
+		OAuthToken: os.Getenv(envName(e.OAuthTokenVar, "KASSA_OAUTH_TOKEN")),
+	}
+	shopIDVar := envName(e.ShopIDVar, "KASSA_SHOP_ID")
+	if value := os.Getenv(shopIDVar); value != "" {
+		shopID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("yandexkassa: %s: %v", shopIDVar, err)
+		}
+		credentials.ShopID = shopID
+	}
+	if !credentials.valid() {
+		return nil, ErrNoCredentials
+	}
+	if previous := os.Getenv(envName(e.PreviousSecretKeyVar, "KASSA_PREVIOUS_SECRET_KEY")); previous != "" {
+		credentials.Previous = &Credentials{ShopID: credentials.ShopID, SecretKey: previous}
+	}
+	return credentials, nil
+}
+
+func envName(name, defaultName string) string {
+	if name != "" {
+		return name
+	}
+	return defaultName
+}
+
+//Данные из JSON-файла вида {"shop_id": 12345, "secret_key": "...", "previous_secret_key": "..."}.
+//Файл перечитывается, если изменился. После смены secret_key прежний ключ отдается как Previous еще Overlap
+type FileCredentials struct {
+	Path          string
+	Overlap       time.Duration    //Сколько отдавать предыдущий ключ после смены. По умолчанию DefaultCredentialsOverlap
+	CheckInterval time.Duration    //Как часто проверять, изменился ли файл. По умолчанию DefaultCredentialsCheckInterval
+	OnError       func(err error)  //Вызывается, если измененный файл не удалось прочитать. Запросы продолжают использовать прежние данные
+	Now           func() time.Time //Текущее время. По умолчанию time.Now
+
+	mu           sync.Mutex
+	current      *Credentials
+	previous     *Credentials
+	previousTill time.Time
+	modTime      time.Time
+	size         int64
+	checkedAt    time.Time
+}
+
+type credentialsFile struct {
+	Credentials
+	PreviousSecretKey string `json:"previous_secret_key,omitempty"` //Предыдущий ключ, который нужно принимать независимо от Overlap
+}
+
+//NewFileCredentials читает данные из файла path. Ошибка возвращается, если файл не удалось прочитать или в нем нет данных
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	f := &FileCredentials{Path: path}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reloadLocked(f.now(), true); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileCredentials) Credentials() (*Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	interval := f.CheckInterval
+	if interval <= 0 {
+		interval = DefaultCredentialsCheckInterval
+	}
+	if f.current == nil || now.Sub(f.checkedAt) >= interval {
+		if err := f.reloadLocked(now, false); err != nil {
+			if f.current == nil {
+				return nil, err
+			}
+			if f.OnError != nil {
+				f.OnError(err)
+			}
+		}
+	}
+
+	credentials := *f.current
+	if credentials.Previous == nil && f.previous != nil && now.Before(f.previousTill) {
+		previous := *f.previous
+		credentials.Previous = &previous
+	}
+	return &credentials, nil
+}
+
+//reloadLocked перечитывает файл, если он изменился с прошлой проверки (или всегда, если force)
+func (f *FileCredentials) reloadLocked(now time.Time, force bool) error {
+	f.checkedAt = now
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	if !force && f.current != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	var file credentialsFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("yandexkassa: credentials file %s: %v", f.Path, err)
+	}
+	if !file.valid() {
+		return fmt.Errorf("yandexkassa: credentials file %s: %v", f.Path, ErrNoCredentials)
+	}
+
+	loaded := file.Credentials
+	if file.PreviousSecretKey != "" {
+		loaded.Previous = &Credentials{ShopID: loaded.ShopID, SecretKey: file.PreviousSecretKey}
+	}
+	if f.current != nil && (f.current.SecretKey != loaded.SecretKey || f.current.OAuthToken != loaded.OAuthToken) {
+		previous := *f.current
+		previous.Previous = nil
+		overlap := f.Overlap
+		if overlap <= 0 {
+			overlap = DefaultCredentialsOverlap
+		}
+		f.previous = &previous
+		f.previousTill = now.Add(overlap)
+	}
+	f.current = &loaded
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return nil
+}
+
+func (f *FileCredentials) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,129 @@
+package yandexkassa_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//staticCredentials отдает одни и те же данные
+type staticCredentials yandexkassa.Credentials
+
+func (s staticCredentials) Credentials() (*yandexkassa.Credentials, error) {
+	credentials := yandexkassa.Credentials(s)
+	return &credentials, nil
+}
+
+func TestFileCredentialsRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kassa.json")
+	if err = ioutil.WriteFile(path, []byte(`{"shop_id": 100500, "secret_key": "old"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	file, err := yandexkassa.NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Now = func() time.Time { return now }
+	file.Overlap = time.Hour
+
+	if err = ioutil.WriteFile(path, []byte(`{"shop_id": 100500, "secret_key": "new_key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * yandexkassa.DefaultCredentialsCheckInterval)
+	credentials, err := file.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.SecretKey != "new_key" || credentials.Previous == nil || credentials.Previous.SecretKey != "old" {
+		t.Fatalf("got %+v, want new_key with the old key as Previous", credentials)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if credentials, _ = file.Credentials(); credentials.Previous != nil {
+		t.Fatal("previous key is still returned after Overlap")
+	}
+}
+
+func TestFileCredentialsKeepsLastGood(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kassa.json")
+	if err = ioutil.WriteFile(path, []byte(`{"shop_id": 100500, "secret_key": "key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := yandexkassa.NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloadErr error
+	file.OnError = func(err error) { reloadErr = err }
+	file.CheckInterval = time.Nanosecond
+
+	if err = ioutil.WriteFile(path, []byte(`{"shop_id": 100500`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := file.Credentials()
+	if err != nil || credentials.SecretKey != "key" {
+		t.Fatalf("got %+v, %v; want the last good credentials", credentials, err)
+	}
+	if reloadErr == nil {
+		t.Fatal("OnError was not called for a broken file")
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("KASSA_SHOP_ID", "100500")
+	t.Setenv("KASSA_SECRET_KEY", "key")
+	t.Setenv("KASSA_OAUTH_TOKEN", "")
+	t.Setenv("KASSA_PREVIOUS_SECRET_KEY", "old")
+
+	credentials, err := yandexkassa.EnvCredentials{}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.ShopID != 100500 || credentials.SecretKey != "key" || credentials.Previous.SecretKey != "old" {
+		t.Fatalf("got %+v", credentials)
+	}
+
+	t.Setenv("KASSA_SECRET_KEY", "")
+	if _, err = (yandexkassa.EnvCredentials{}).Credentials(); err != yandexkassa.ErrNoCredentials {
+		t.Fatalf("got %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestPreviousKeyRetry(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	srv.SecretKey = "old"
+
+	//Новый ключ уже в конфигурации, но Яндекс.Касса его еще не принимает: запрос повторяется с прежним
+	kassa := &yandexkassa.Kassa{BaseURL: srv.URL + "/v3", Credentials: staticCredentials{
+		ShopID: srv.ShopID, SecretKey: "new",
+		Previous: &yandexkassa.Credentials{ShopID: srv.ShopID, SecretKey: "old"}}}
+	if _, _, err := kassa.WithIdempotenceKey("order-1").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	kassa.Credentials = staticCredentials{ShopID: srv.ShopID, SecretKey: "new"}
+	_, _, err := kassa.PaymentInfo("unknown")
+	if apiErr, ok := yandexkassa.IsYandexError(err); !ok || apiErr.Code != yandexkassa.ErrorInvalidCredentials {
+		t.Fatalf("got %v, want invalid_credentials", err)
+	}
+}
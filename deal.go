@@ -0,0 +1,144 @@
+package yandexkassa
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+/*
+	Безопасная сделка: деньги покупателя задерживаются на сделке, пока продавец не выполнит обязательства,
+	а затем выплачиваются продавцу (CreatePayout с Deal) или возвращаются покупателю. Платежи и возвраты
+	привязываются к сделке полем Deal. О закрытии сделки Яндекс.Касса сообщает уведомлением deal.closed.
+*/
+
+const DealTypeSafeDeal = "safe_deal"
+
+//Момент, когда удерживается вознаграждение платформы (поле fee_moment)
+const (
+	FeeMomentPaymentSucceeded = "payment_succeeded" //При успешной оплате
+	FeeMomentDealClosed       = "deal_closed"       //При закрытии сделки
+)
+
+const (
+	DealStatusOpened = "opened"
+	DealStatusClosed = "closed"
+)
+
+//Тип расчета по сделке (поле type в Settlement)
+const SettlementTypePayout = "payout"
+
+type DealRequest struct {
+	Type        string                 `json:"type"`                  //Тип сделки, DealTypeSafeDeal
+	FeeMoment   string                 `json:"fee_moment"`            //Момент удержания вознаграждения платформы: payment_succeeded или deal_closed
+	Description string                 `json:"description,omitempty"` //Описание сделки, до 128 символов
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`    //Дополнительные данные сделки
+}
+
+type Deal struct {
+	ID            string                 `json:"id"`                    //Идентификатор сделки
+	Type          string                 `json:"type"`                  //Тип сделки, safe_deal
+	FeeMoment     string                 `json:"fee_moment"`            //Момент удержания вознаграждения платформы
+	Description   string                 `json:"description,omitempty"` //Описание сделки
+	Balance       Amount                 `json:"balance"`               //Баланс сделки: сколько денег покупателя сейчас на ней
+	PayoutBalance Amount                 `json:"payout_balance"`        //Сколько еще можно выплатить продавцу
+	Status        string                 `json:"status"`                //Статус сделки: opened или closed
+	CreatedAt     string                 `json:"created_at"`            //Время создания сделки, ISO 8601 по UTC
+	ExpiresAt     string                 `json:"expires_at"`            //Время автоматического закрытия сделки, ISO 8601 по UTC
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`    //Дополнительные данные сделки
+	Test          bool                   `json:"test"`                  //Признак тестовой операции
+}
+
+//Время создания сделки
+func (d *Deal) CreatedTime() (time.Time, error) {
+	return ParseTime(d.CreatedAt)
+}
+
+//Время автоматического закрытия сделки
+func (d *Deal) ExpiresTime() (time.Time, error) {
+	return ParseTime(d.ExpiresAt)
+}
+
+//Расчет по сделке: какая часть платежа или возврата приходится на выплату продавцу
+type Settlement struct {
+	Type   string `json:"type"`   //Тип расчета, SettlementTypePayout
+	Amount Amount `json:"amount"` //Сумма расчета
+}
+
+//Сделка в платеже (PaymentRequest.Deal, Payment.Deal)
+type PaymentDeal struct {
+	ID          string       `json:"id"`                    //Идентификатор сделки
+	Settlements []Settlement `json:"settlements,omitempty"` //Какая часть платежа будет выплачена продавцу
+}
+
+//Сделка в возврате (RefundRequest.Deal, Refund.Deal)
+type RefundDeal struct {
+	ID                string       `json:"id,omitempty"`                 //Идентификатор сделки. Присутствует в ответе
+	RefundSettlements []Settlement `json:"refund_settlements,omitempty"` //Какая часть возврата списывается с суммы, предназначенной продавцу
+}
+
+//Фильтр для получения списка сделок. Пустые поля не передаются
+type DealListFilter struct {
+	CreatedAt      TimeFilter //Фильтр по времени создания сделки
+	ExpiresAt      TimeFilter //Фильтр по времени автоматического закрытия сделки
+	Status         string     //Статус сделки (opened, closed)
+	FullTextSearch string     //Поиск по описанию сделки, от 4 символов
+	Limit          int        //Размер выдачи результатов запроса, от 1 до 100
+	Cursor         string     //Указатель на следующий фрагмент списка (next_cursor из предыдущего ответа)
+}
+
+func (f *DealListFilter) values() url.Values {
+	values := url.Values{}
+	if f == nil {
+		return values
+	}
+	f.CreatedAt.encode(values)
+	f.ExpiresAt.encodeAs(values, "expires_at")
+	setString(values, "status", f.Status)
+	setString(values, "full_text_search", f.FullTextSearch)
+	setInt(values, "limit", f.Limit)
+	setString(values, "cursor", f.Cursor)
+	return values
+}
+
+type DealList struct {
+	Type       string `json:"type"`        //Формат выдачи результатов запроса (list)
+	Items      []Deal `json:"items"`       //Список сделок
+	NextCursor string `json:"next_cursor"` //Указатель на следующий фрагмент списка. Отсутствует, если это последний фрагмент
+}
+
+//CreateDeal создает сделку. Если Type не указан, создается безопасная сделка
+func (k *Kassa) CreateDeal(inputDeal *DealRequest) (*Deal, *Processing, error) {
+	request := *inputDeal
+	if request.Type == "" {
+		request.Type = DealTypeSafeDeal
+	}
+	var deal Deal
+	processing, err := k.do(http.MethodPost, "/deals", &request, &deal)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &deal, nil, nil
+}
+
+func (k *Kassa) DealInfo(dealID string) (*Deal, *Processing, error) {
+	var deal Deal
+	processing, err := k.do(http.MethodGet, "/deals/"+url.PathEscape(dealID), nil, &deal)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &deal, nil, nil
+}
+
+func (k *Kassa) ListDeals(filter *DealListFilter) (*DealList, *Processing, error) {
+	path := "/deals"
+	if query := filter.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	var list DealList
+	processing, err := k.do(http.MethodGet, path, nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &list, nil, nil
+}
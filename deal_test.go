@@ -0,0 +1,179 @@
+package yandexkassa_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func TestDealJSON(t *testing.T) {
+	//Ответ Яндекс.Кассы в формате документации API на создание сделки
+	sample := `{"type":"safe_deal","fee_moment":"payment_succeeded","id":"dl-2909e77d-0022-5000-8000-0c37205b3208","balance":{"value":"0.00","currency":"RUB"},"payout_balance":{"value":"0.00","currency":"RUB"},"status":"opened","created_at":"2021-06-18T07:28:39.390497Z","expires_at":"2021-09-16T07:28:39.390513Z","metadata":{"order_id":"37"},"description":"SAFE_DEAL 123554642-2432FF344R","test":false}`
+	var deal yandexkassa.Deal
+	if err := json.Unmarshal([]byte(sample), &deal); err != nil {
+		t.Fatal(err)
+	}
+	if deal.Type != yandexkassa.DealTypeSafeDeal || deal.Status != yandexkassa.DealStatusOpened || deal.PayoutBalance.Value != "0.00" {
+		t.Fatalf("got %+v", deal)
+	}
+	if expires, err := deal.ExpiresTime(); err != nil || expires.Month() != 9 {
+		t.Fatalf("got expires_at %v, %v", expires, err)
+	}
+
+	data, err := json.Marshal(&deal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again yandexkassa.Deal
+	if err = json.Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, deal) {
+		t.Fatalf("round trip changed the deal:\n%+v\n%+v", deal, again)
+	}
+}
+
+func TestDealLifecycle(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+
+	var (
+		mu      sync.Mutex
+		closed  []string
+		payouts []string
+	)
+	hook := httptest.NewServer(kassa.DealNotification(func(k *yandexkassa.Kassa, deal *yandexkassa.Deal) error {
+		mu.Lock()
+		defer mu.Unlock()
+		closed = append(closed, deal.ID)
+		return nil
+	}, func(k *yandexkassa.Kassa, payout *yandexkassa.Payout) error {
+		mu.Lock()
+		defer mu.Unlock()
+		payouts = append(payouts, payout.ID+" "+payout.Status)
+		return nil
+	}))
+	defer hook.Close()
+	srv.WebhookURL = hook.URL
+
+	deal, _, err := kassa.WithIdempotenceKey("deal-1").CreateDeal(&yandexkassa.DealRequest{
+		FeeMoment: yandexkassa.FeeMomentPaymentSucceeded, Description: "Заказ №37"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deal.Type != yandexkassa.DealTypeSafeDeal || deal.Status != yandexkassa.DealStatusOpened {
+		t.Fatalf("created %+v", deal)
+	}
+	if _, _, err = kassa.WithIdempotenceKey("deal-2").CreateDeal(&yandexkassa.DealRequest{FeeMoment: "later"}); err == nil {
+		t.Fatal("deal with an invalid fee_moment created")
+	}
+
+	//Из 10.00 продавцу причитается 9.00, а при возврате 2.00 с его части списывается 1.50
+	payment, _, err := kassa.WithIdempotenceKey("deal-payment").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            rub("10.00"),
+		PaymentMethodData: yandexkassa.BankCardData{},
+		Capture:           true,
+		Deal: &yandexkassa.PaymentDeal{ID: deal.ID, Settlements: []yandexkassa.Settlement{
+			{Type: yandexkassa.SettlementTypePayout, Amount: rub("9.00")}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = kassa.WithIdempotenceKey("deal-refund").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: rub("2.00"),
+		Deal: &yandexkassa.RefundDeal{RefundSettlements: []yandexkassa.Settlement{
+			{Type: yandexkassa.SettlementTypePayout, Amount: rub("1.50")}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _, err := kassa.DealInfo(deal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Balance.Value != "8.00" || info.PayoutBalance.Value != "7.50" {
+		t.Fatalf("balance %s, payout balance %s; want 8.00 and 7.50", info.Balance.Value, info.PayoutBalance.Value)
+	}
+
+	payout, _, err := kassa.WithIdempotenceKey("deal-payout").CreatePayout(&yandexkassa.PayoutRequest{
+		Amount:                rub("7.50"),
+		PayoutDestinationData: &yandexkassa.PayoutDestination{Type: yandexkassa.PayoutDestinationBankCard, Card: &yandexkassa.PayoutCard{Number: "5555555555554477"}},
+		Deal:                  &yandexkassa.PayoutDeal{ID: deal.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.CloseDeal(deal.ID); err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+	if errs := srv.WebhookErrors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(closed, []string{deal.ID}) || !reflect.DeepEqual(payouts, []string{payout.ID + " succeeded"}) {
+		t.Fatalf("notified about deals %v and payouts %v", closed, payouts)
+	}
+	mu.Unlock()
+
+	other, _, err := kassa.WithIdempotenceKey("deal-3").CreateDeal(&yandexkassa.DealRequest{FeeMoment: yandexkassa.FeeMomentDealClosed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _, err := kassa.ListDeals(&yandexkassa.DealListFilter{Status: yandexkassa.DealStatusClosed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].ID != deal.ID {
+		t.Fatalf("closed deals %+v", list.Items)
+	}
+	list, _, err = kassa.ListDeals(&yandexkassa.DealListFilter{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].ID != other.ID || list.NextCursor == "" {
+		t.Fatalf("first page %+v", list)
+	}
+	if list, _, err = kassa.ListDeals(&yandexkassa.DealListFilter{Limit: 1, Cursor: list.NextCursor}); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].ID != deal.ID {
+		t.Fatalf("second page %+v", list)
+	}
+}
+
+func TestDealNotificationStatus(t *testing.T) {
+	kassa := &yandexkassa.Kassa{}
+	failing := kassa.DealNotification(func(*yandexkassa.Kassa, *yandexkassa.Deal) error {
+		return errors.New("database is down")
+	}, nil)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"malformed", `{"type":`, http.StatusBadRequest},
+		{"handler error", `{"type":"notification","event":"deal.closed","object":{"id":"dl-1","status":"closed"}}`, http.StatusInternalServerError},
+		{"no payout handler", `{"type":"notification","event":"payout.succeeded","object":{"id":"po-1","status":"succeeded"}}`, http.StatusOK},
+		{"other event", `{"type":"notification","event":"payment.succeeded","object":{"id":"p-1"}}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			failing(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+			if recorder.Code != test.code {
+				t.Fatalf("got %d, want %d", recorder.Code, test.code)
+			}
+		})
+	}
+}
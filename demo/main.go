@@ -165,9 +165,10 @@ func succeedPayment(k *yandexkassa.Kassa, p *yandexkassa.Payment) error {
 }
 
 func main() {
+	//Данные магазина берутся из KASSA_SHOP_ID и KASSA_SECRET_KEY перед каждым запросом.
+	//Во время смены ключа прежний можно оставить в KASSA_PREVIOUS_SECRET_KEY
 	kassa := &yandexkassa.Kassa{
-		ShopID:         12345,
-		SecretKey:      "testSecrectKey",
+		Credentials:    yandexkassa.EnvCredentials{},
 		IdempotenceKey: "testIdempotenceKey"}
 
 	router := http.NewServeMux()
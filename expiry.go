@@ -0,0 +1,199 @@
+package yandexkassa
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+	ExpiryWatcher следит за платежами в статусе waiting_for_capture и за Lead до их ExpiresAt
+	спрашивает у Policy, что с ними сделать: подтвердить, отменить или только сообщить.
+	Иначе Яндекс.Касса сама отменит такой платеж с причиной expired_on_capture.
+*/
+
+type ExpiryAction int
+
+const (
+	ExpiryCapture ExpiryAction = iota + 1 //Подтвердить платеж на всю сумму (PaymentConfirm)
+	ExpiryCancel                          //Отменить платеж (PaymentCancel)
+	ExpiryAlert                           //Ничего не делать, только вызвать Alert
+)
+
+//Шаг проверки по умолчанию и время до ExpiresAt, за которое вызывается Policy
+const (
+	DefaultExpiryInterval = time.Minute
+	DefaultExpiryLead     = time.Hour
+)
+
+type ExpiryWatcher struct {
+	Kassa    *Kassa
+	Policy   func(payment *Payment) ExpiryAction //Решение для платежа, срок которого подходит к концу. Если не задана, используется ExpiryAlert: деньги не списываются без явного решения
+	Alert    func(payment *Payment)              //Вызывается один раз для платежей, по которым Policy вернула ExpiryAlert
+	OnError  func(payment *Payment, err error)   //Вызывается при ошибке запроса. Платеж остается под наблюдением и будет обработан на следующем шаге
+	Lead     time.Duration                       //За сколько до ExpiresAt вызывать Policy. По умолчанию DefaultExpiryLead
+	Interval time.Duration                       //Как часто проверять платежи в Run. По умолчанию DefaultExpiryInterval
+	Now      func() time.Time                    //Текущее время. По умолчанию time.Now
+
+	mu      sync.Mutex
+	tracked map[string]*trackedPayment
+}
+
+type trackedPayment struct {
+	payment   Payment
+	expiresAt time.Time
+	alerted   bool
+}
+
+//Track добавляет платеж под наблюдение. Платежи не в статусе waiting_for_capture или без ExpiresAt пропускаются
+func (w *ExpiryWatcher) Track(payment *Payment) error {
+	if payment.Status != PaymentStatusWaitingForCapture {
+		w.Untrack(payment.ID)
+		return nil
+	}
+	expiresAt, err := payment.ExpiresTime()
+	if err != nil || expiresAt.IsZero() {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tracked == nil {
+		w.tracked = map[string]*trackedPayment{}
+	}
+	if tracked, ok := w.tracked[payment.ID]; ok {
+		tracked.payment, tracked.expiresAt = *payment, expiresAt
+		return nil
+	}
+	w.tracked[payment.ID] = &trackedPayment{payment: *payment, expiresAt: expiresAt}
+	return nil
+}
+
+//Untrack снимает платеж с наблюдения, например после того как вы сами его подтвердили
+func (w *ExpiryWatcher) Untrack(paymentID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.tracked, paymentID)
+}
+
+//Tracked возвращает количество платежей под наблюдением
+func (w *ExpiryWatcher) Tracked() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.tracked)
+}
+
+//Run проверяет платежи каждые Interval, пока не завершится ctx. Если у Kassa есть Store,
+//сначала под наблюдение берутся сохраненные в нем платежи в статусе waiting_for_capture
+func (w *ExpiryWatcher) Run(ctx context.Context) error {
+	if w.Kassa.Store != nil {
+		payments, err := w.Kassa.Store.PaymentsByStatus(PaymentStatusWaitingForCapture)
+		if err != nil {
+			return err
+		}
+		for i := range payments {
+			if err = w.Track(&payments[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultExpiryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.Check()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//Check обрабатывает платежи, срок подтверждения которых наступит в течение Lead
+func (w *ExpiryWatcher) Check() {
+	lead := w.Lead
+	if lead <= 0 {
+		lead = DefaultExpiryLead
+	}
+	now := time.Now
+	if w.Now != nil {
+		now = w.Now
+	}
+	deadline := now().Add(lead)
+
+	//Track может обновить платеж в любой момент, поэтому handle получает копии, сделанные под блокировкой
+	w.mu.Lock()
+	var due []Payment
+	for _, tracked := range w.tracked {
+		if !tracked.alerted && !tracked.expiresAt.After(deadline) {
+			due = append(due, tracked.payment)
+		}
+	}
+	w.mu.Unlock()
+
+	for i := range due {
+		w.handle(&due[i])
+	}
+}
+
+func (w *ExpiryWatcher) handle(tracked *Payment) {
+	paymentID := tracked.ID
+
+	//Статус мог измениться без уведомления, поэтому перед действием платеж запрашивается заново
+	payment, processing, err := w.Kassa.PaymentInfo(paymentID)
+	if err != nil {
+		w.fail(tracked, err)
+		return
+	}
+	if processing != nil {
+		return
+	}
+	if payment.Status != PaymentStatusWaitingForCapture {
+		w.Untrack(paymentID)
+		return
+	}
+
+	action := ExpiryAlert
+	if w.Policy != nil {
+		action = w.Policy(payment)
+	}
+
+	switch action {
+	case ExpiryCapture:
+		kassa := w.Kassa.WithIdempotenceKey("expiry-watcher-capture-" + paymentID)
+		_, processing, err = kassa.CapturePayment(payment, nil)
+	case ExpiryCancel:
+		kassa := w.Kassa.WithIdempotenceKey("expiry-watcher-cancel-" + paymentID)
+		_, processing, err = kassa.PaymentCancel(paymentID)
+	default:
+		w.mu.Lock()
+		if entry, ok := w.tracked[paymentID]; ok {
+			entry.alerted = true
+		}
+		w.mu.Unlock()
+		if w.Alert != nil {
+			w.Alert(payment)
+		}
+		return
+	}
+
+	if err != nil {
+		w.fail(payment, err)
+		return
+	}
+	if processing == nil {
+		w.Untrack(paymentID)
+	}
+}
+
+func (w *ExpiryWatcher) fail(payment *Payment, err error) {
+	if w.OnError != nil {
+		w.OnError(payment, err)
+	}
+}
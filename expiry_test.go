@@ -0,0 +1,132 @@
+package yandexkassa_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//authorizedPayment создает платеж и переводит его в waiting_for_capture
+func authorizedPayment(t *testing.T, srv *kassatest.Server, key string) *yandexkassa.Payment {
+	t.Helper()
+	payment, _, err := srv.Kassa().WithIdempotenceKey(key).CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if payment, _, err = srv.Kassa().PaymentInfo(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func TestExpiryWatcherPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  func(*yandexkassa.Payment) yandexkassa.ExpiryAction
+		status  string
+		alerted bool
+	}{
+		{"capture", func(*yandexkassa.Payment) yandexkassa.ExpiryAction { return yandexkassa.ExpiryCapture },
+			yandexkassa.PaymentStatusSucceeded, false},
+		{"cancel", func(*yandexkassa.Payment) yandexkassa.ExpiryAction { return yandexkassa.ExpiryCancel },
+			yandexkassa.PaymentStatusCanceled, false},
+		{"alert", func(*yandexkassa.Payment) yandexkassa.ExpiryAction { return yandexkassa.ExpiryAlert },
+			yandexkassa.PaymentStatusWaitingForCapture, true},
+		{"no policy", nil, yandexkassa.PaymentStatusWaitingForCapture, true},
+	}
+	for _, test := range tests {
+		srv := kassatest.NewServer()
+		payment := authorizedPayment(t, srv, "order-1")
+
+		var alerts []string
+		watcher := &yandexkassa.ExpiryWatcher{
+			Kassa:   srv.Kassa(),
+			Policy:  test.policy,
+			Alert:   func(p *yandexkassa.Payment) { alerts = append(alerts, p.ID) },
+			OnError: func(p *yandexkassa.Payment, err error) { t.Errorf("%s: %s: %v", test.name, p.ID, err) },
+			Lead:    30 * 24 * time.Hour}
+		if err := watcher.Track(payment); err != nil {
+			t.Fatal(err)
+		}
+		watcher.Check()
+		watcher.Check()
+
+		stored, _ := srv.Payment(payment.ID)
+		if stored.Status != test.status {
+			t.Errorf("%s: payment is %s, want %s", test.name, stored.Status, test.status)
+		}
+		if test.alerted && (len(alerts) != 1 || watcher.Tracked() != 1) {
+			t.Errorf("%s: got alerts %v and %d tracked, want one alert and the payment still tracked", test.name, alerts, watcher.Tracked())
+		}
+		if !test.alerted && (len(alerts) != 0 || watcher.Tracked() != 0) {
+			t.Errorf("%s: got alerts %v and %d tracked, want no alerts and no tracked payments", test.name, alerts, watcher.Tracked())
+		}
+		srv.Close()
+	}
+}
+
+func TestExpiryWatcherSkipsLaterPayments(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	payment := authorizedPayment(t, srv, "order-1")
+
+	watcher := &yandexkassa.ExpiryWatcher{
+		Kassa:  srv.Kassa(),
+		Policy: func(*yandexkassa.Payment) yandexkassa.ExpiryAction { return yandexkassa.ExpiryCapture }}
+	if err := watcher.Track(payment); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Check()
+	if stored, _ := srv.Payment(payment.ID); stored.Status != yandexkassa.PaymentStatusWaitingForCapture {
+		t.Fatalf("payment expiring in days was handled: %s", stored.Status)
+	}
+}
+
+func TestExpiryWatcherTrackDuringCheck(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	payment := authorizedPayment(t, srv, "order-1")
+
+	//Отмененный платеж снова приходит в Track со старым статусом, поэтому каждый Check обрабатывает его заново
+	watcher := &yandexkassa.ExpiryWatcher{
+		Kassa:   srv.Kassa(),
+		Policy:  func(*yandexkassa.Payment) yandexkassa.ExpiryAction { return yandexkassa.ExpiryCancel },
+		OnError: func(p *yandexkassa.Payment, err error) { t.Error(err) },
+		Lead:    30 * 24 * time.Hour}
+
+	if err := watcher.Track(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			update := *payment
+			if err := watcher.Track(&update); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		watcher.Check()
+	}
+	close(stop)
+	wg.Wait()
+}
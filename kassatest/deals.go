@@ -0,0 +1,185 @@
+package kassatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"yandexkassa"
+)
+
+//Срок, через который тестовая сделка закрывается автоматически
+const DefaultDealTimeout = 90 * 24 * time.Hour
+
+func (s *Server) createDeal(w http.ResponseWriter, body []byte) {
+	var request yandexkassa.DealRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+	if request.Type != yandexkassa.DealTypeSafeDeal {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "type", "Unsupported deal type")
+		return
+	}
+	if request.FeeMoment != yandexkassa.FeeMomentPaymentSucceeded && request.FeeMoment != yandexkassa.FeeMomentDealClosed {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "fee_moment", "Invalid fee_moment value")
+		return
+	}
+
+	s.mu.Lock()
+	deal := &yandexkassa.Deal{
+		ID:            s.nextID("0de1"),
+		Type:          request.Type,
+		FeeMoment:     request.FeeMoment,
+		Description:   request.Description,
+		Balance:       yandexkassa.NewAmount(0, "RUB"),
+		PayoutBalance: yandexkassa.NewAmount(0, "RUB"),
+		Status:        yandexkassa.DealStatusOpened,
+		CreatedAt:     s.now(),
+		ExpiresAt:     yandexkassa.FormatTime(s.Now().Add(DefaultDealTimeout)),
+		Metadata:      request.Metadata,
+		Test:          true,
+	}
+	s.deals[deal.ID] = deal
+	s.dealOrder = append(s.dealOrder, deal.ID)
+	response := *deal
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+}
+
+func (s *Server) getDeal(w http.ResponseWriter, dealID string) {
+	s.mu.Lock()
+	deal, ok := s.deals[dealID]
+	var response yandexkassa.Deal
+	if ok {
+		response = *deal
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "deal_id", "Deal not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &response)
+}
+
+func (s *Server) listDeals(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var items []yandexkassa.Deal
+	for i := len(s.dealOrder) - 1; i >= 0; i-- {
+		deal := s.deals[s.dealOrder[i]]
+		if status := query.Get("status"); status != "" && deal.Status != status {
+			continue
+		}
+		created, err := matchTime(r, "created_at", deal.CreatedAt)
+		if err == nil && created {
+			created, err = matchTime(r, "expires_at", deal.ExpiresAt)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid filter value")
+			return
+		}
+		if created {
+			items = append(items, *deal)
+		}
+	}
+	s.mu.Unlock()
+
+	from, to, nextCursor, err := listWindow(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid list parameter")
+		return
+	}
+	writeJSON(w, http.StatusOK, &yandexkassa.DealList{
+		Type:       "list",
+		Items:      append([]yandexkassa.Deal{}, items[from:to]...),
+		NextCursor: nextCursor})
+}
+
+//Deal возвращает копию сделки
+func (s *Server) Deal(dealID string) (*yandexkassa.Deal, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deal, ok := s.deals[dealID]
+	if !ok {
+		return nil, false
+	}
+	copied := *deal
+	return &copied, true
+}
+
+//CloseDeal закрывает сделку и отправляет уведомление deal.closed
+func (s *Server) CloseDeal(dealID string) error {
+	s.mu.Lock()
+	deal, ok := s.deals[dealID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("kassatest: deal %s not found", dealID)
+	}
+	if deal.Status == yandexkassa.DealStatusClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	deal.Status = yandexkassa.DealStatusClosed
+	response := *deal
+	s.mu.Unlock()
+
+	s.deliver([]pendingNotification{{yandexkassa.EventDealClosed, &response}})
+	return nil
+}
+
+//creditDealLocked зачисляет успешный платеж на сделку. Продавцу причитается сумма расчетов (settlements),
+//а если они не указаны — весь платеж
+func (s *Server) creditDealLocked(payment *yandexkassa.Payment) {
+	if payment.Deal == nil {
+		return
+	}
+	deal, ok := s.deals[payment.Deal.ID]
+	if !ok {
+		return
+	}
+	amount, _ := payment.Amount.MinorUnits()
+	payout := amount
+	if len(payment.Deal.Settlements) > 0 {
+		payout = settlementsTotal(payment.Deal.Settlements)
+	}
+	addToAmount(&deal.Balance, amount)
+	addToAmount(&deal.PayoutBalance, payout)
+}
+
+//debitDealLocked списывает возврат со сделки платежа
+func (s *Server) debitDealLocked(payment *yandexkassa.Payment, refund *yandexkassa.Refund) {
+	if payment.Deal == nil {
+		return
+	}
+	deal, ok := s.deals[payment.Deal.ID]
+	if !ok {
+		return
+	}
+	amount, _ := refund.Amount.MinorUnits()
+	payout := amount
+	if refund.Deal != nil && len(refund.Deal.RefundSettlements) > 0 {
+		payout = settlementsTotal(refund.Deal.RefundSettlements)
+	}
+	addToAmount(&deal.Balance, -amount)
+	addToAmount(&deal.PayoutBalance, -payout)
+}
+
+func settlementsTotal(settlements []yandexkassa.Settlement) int64 {
+	var total int64
+	for _, settlement := range settlements {
+		value, _ := settlement.Amount.MinorUnits()
+		total += value
+	}
+	return total
+}
+
+func addToAmount(amount *yandexkassa.Amount, delta int64) {
+	value, _ := amount.MinorUnits()
+	*amount = yandexkassa.NewAmount(value+delta, amount.Currency)
+}
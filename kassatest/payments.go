@@ -0,0 +1,446 @@
+package kassatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yandexkassa"
+)
+
+func (s *Server) createPayment(w http.ResponseWriter, body []byte) {
+	var request yandexkassa.PaymentRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+	if units, err := request.Amount.MinorUnits(); err != nil || units <= 0 {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.value", "Invalid amount value")
+		return
+	}
+	if request.Amount.Currency == "" {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.currency", "Currency is required")
+		return
+	}
+
+	s.mu.Lock()
+	var method yandexkassa.PaymentMethod
+	if request.PaymentMethodId != "" {
+		saved, ok := s.methods[request.PaymentMethodId]
+		if !ok || !saved.Common().Saved {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "payment_method_id", "Payment method is not saved")
+			return
+		}
+		method = saved
+	} else {
+		method = newMethod(s.nextID("000a"), request.PaymentMethodData)
+	}
+
+	payment := &yandexkassa.Payment{
+		ID:          s.nextID("000f"),
+		Status:      yandexkassa.PaymentStatusPending,
+		Amount:      request.Amount,
+		Description: request.Description,
+		Recipient: yandexkassa.Recipient{
+			AccountID: strconv.FormatInt(s.ShopID, 10),
+			GatewayID: request.Recipient.GatewayID},
+		PaymentMethod: method,
+		CreatedAt:     s.now(),
+		Test:          true,
+		Metadata:      request.Metadata,
+		Transfers:     append([]yandexkassa.Transfer(nil), request.Transfers...),
+		Deal:          request.Deal,
+	}
+	setTransferStatus(payment)
+	if request.Confirmation.Type != "" {
+		payment.Confirmation = s.confirmationFor(payment.ID, request.Confirmation)
+	}
+	s.payments[payment.ID] = payment
+	s.paymentOrder = append(s.paymentOrder, payment.ID)
+	s.requests[payment.ID] = &request
+
+	var notifications []pendingNotification
+	steps, scripted := s.findScriptLocked(&request)
+	if !scripted && request.PaymentMethodId != "" {
+		//Безакцептное списание с сохраненного способа оплаты не требует подтверждения пользователем
+		notifications = s.authorizeLocked(payment)
+	}
+	response := *copyPayment(payment)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+	s.deliverAfter(w, notifications)
+	if scripted {
+		s.runScript(w, payment.ID, steps)
+	}
+}
+
+func (s *Server) getPayment(w http.ResponseWriter, paymentID string) {
+	s.mu.Lock()
+	notifications := s.expireLocked()
+	payment, ok := s.payments[paymentID]
+	var response yandexkassa.Payment
+	if ok {
+		response = *copyPayment(payment)
+	}
+	s.mu.Unlock()
+	s.deliverAfter(w, notifications)
+
+	if !ok {
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "payment_id", "Payment not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &response)
+}
+
+func (s *Server) capturePayment(w http.ResponseWriter, paymentID string, body []byte) {
+	var request struct {
+		Amount    *yandexkassa.Amount    `json:"amount"`
+		Transfers []yandexkassa.Transfer `json:"transfers"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	notifications := s.expireLocked()
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		s.mu.Unlock()
+		s.deliverAfter(w, notifications)
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "payment_id", "Payment not found")
+		return
+	}
+	if payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+		s.mu.Unlock()
+		s.deliverAfter(w, notifications)
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "payment_id",
+			"Payment is in status "+payment.Status+" and can't be captured")
+		return
+	}
+
+	if request.Amount != nil && request.Amount.Value != "" {
+		captured, err := request.Amount.MinorUnits()
+		authorized, _ := payment.Amount.MinorUnits()
+		if err != nil || captured <= 0 || captured > authorized || request.Amount.Currency != payment.Amount.Currency {
+			s.mu.Unlock()
+			s.deliverAfter(w, notifications)
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount",
+				"Capture amount must be positive and not greater than the authorized amount")
+			return
+		}
+		payment.Amount = *request.Amount
+	}
+	if len(request.Transfers) > 0 {
+		payment.Transfers = append([]yandexkassa.Transfer(nil), request.Transfers...)
+	}
+
+	notifications = append(notifications, s.succeedLocked(payment)...)
+	response := *copyPayment(payment)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+	s.deliverAfter(w, notifications)
+}
+
+func (s *Server) cancelPayment(w http.ResponseWriter, paymentID string) {
+	s.mu.Lock()
+	notifications := s.expireLocked()
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		s.mu.Unlock()
+		s.deliverAfter(w, notifications)
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "payment_id", "Payment not found")
+		return
+	}
+	if payment.Status != yandexkassa.PaymentStatusPending && payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+		s.mu.Unlock()
+		s.deliverAfter(w, notifications)
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "payment_id",
+			"Payment is in status "+payment.Status+" and can't be canceled")
+		return
+	}
+
+	notifications = append(notifications, s.cancelLocked(payment,
+		yandexkassa.CancellationPartyMerchant, yandexkassa.CancellationReasonCanceledByMerchant)...)
+	response := *copyPayment(payment)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+	s.deliverAfter(w, notifications)
+}
+
+func (s *Server) listPayments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	notifications := s.expireLocked()
+	var items []yandexkassa.Payment
+	for i := len(s.paymentOrder) - 1; i >= 0; i-- {
+		payment := s.payments[s.paymentOrder[i]]
+		if status := query.Get("status"); status != "" && payment.Status != status {
+			continue
+		}
+		if method := query.Get("payment_method"); method != "" && (payment.PaymentMethod == nil || payment.PaymentMethod.Type() != method) {
+			continue
+		}
+		ok, err := matchTime(r, "created_at", payment.CreatedAt)
+		if err == nil && ok {
+			ok, err = matchTime(r, "captured_at", payment.CapturedAt)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			s.deliverAfter(w, notifications)
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid filter value")
+			return
+		}
+		if ok {
+			items = append(items, *copyPayment(payment))
+		}
+	}
+	s.mu.Unlock()
+	s.deliverAfter(w, notifications)
+
+	from, to, nextCursor, err := listWindow(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid list parameter")
+		return
+	}
+	writeJSON(w, http.StatusOK, &yandexkassa.PaymentList{
+		Type:       "list",
+		Items:      append([]yandexkassa.Payment{}, items[from:to]...),
+		NextCursor: nextCursor})
+}
+
+//authorizeLocked переводит платеж в статус waiting_for_capture или succeeded после подтверждения пользователем
+func (s *Server) authorizeLocked(payment *yandexkassa.Payment) []pendingNotification {
+	request := s.requests[payment.ID]
+	payment.Paid = true
+	payment.Confirmation = yandexkassa.ConfirmationResponse{}
+
+	if request.SavePaymentMethod && payment.PaymentMethod != nil {
+		payment.PaymentMethod = markSaved(payment.PaymentMethod)
+		s.methods[payment.PaymentMethod.Common().ID] = payment.PaymentMethod
+	}
+	if method, ok := payment.PaymentMethod.(*yandexkassa.SbpMethod); ok {
+		paid := *method
+		paid.SbpOperationID = "sbp-" + payment.ID
+		paid.PayerBankDetails = &yandexkassa.PayerBankDetails{BankID: SbpBanks[0].BankID, BIC: SbpBanks[0].BIC}
+		payment.PaymentMethod = &paid
+	}
+	if payment.PaymentMethod != nil && payment.PaymentMethod.Type() == yandexkassa.PaymentMethodBankCard {
+		payment.AuthorizationDetails = &yandexkassa.AuthorizationDetails{
+			RRN:      "603668680243",
+			AuthCode: "000000"}
+	}
+
+	if request.Capture {
+		return s.succeedLocked(payment)
+	}
+	payment.Status = yandexkassa.PaymentStatusWaitingForCapture
+	payment.ExpiresAt = yandexkassa.FormatTime(s.Now().Add(s.CaptureTimeout))
+	setTransferStatus(payment)
+	return []pendingNotification{{yandexkassa.EventPaymentWaitingForCapture, copyPayment(payment)}}
+}
+
+func (s *Server) succeedLocked(payment *yandexkassa.Payment) []pendingNotification {
+	payment.Status = yandexkassa.PaymentStatusSucceeded
+	payment.Paid = true
+	payment.CapturedAt = s.now()
+	payment.ExpiresAt = ""
+	setTransferStatus(payment)
+	s.creditDealLocked(payment)
+	return []pendingNotification{{yandexkassa.EventPaymentSucceeded, copyPayment(payment)}}
+}
+
+func (s *Server) cancelLocked(payment *yandexkassa.Payment, party yandexkassa.CancellationParty, reason yandexkassa.CancellationReason) []pendingNotification {
+	payment.Status = yandexkassa.PaymentStatusCanceled
+	payment.Paid = false
+	payment.ExpiresAt = ""
+	payment.Confirmation = yandexkassa.ConfirmationResponse{}
+	payment.CancellationDetails = &yandexkassa.CancellationDetails{Party: party, Reason: reason}
+	setTransferStatus(payment)
+	return []pendingNotification{{yandexkassa.EventPaymentCanceled, copyPayment(payment)}}
+}
+
+//expireLocked отменяет платежи, которые не были подтверждены до ExpiresAt
+func (s *Server) expireLocked() []pendingNotification {
+	now := s.Now()
+	var notifications []pendingNotification
+	for _, id := range s.paymentOrder {
+		payment := s.payments[id]
+		if payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+			continue
+		}
+		expiresAt, err := yandexkassa.ParseTime(payment.ExpiresAt)
+		if err != nil || expiresAt.IsZero() || now.Before(expiresAt) {
+			continue
+		}
+		notifications = append(notifications, s.cancelLocked(payment,
+			yandexkassa.CancellationPartyYandexCheckout, yandexkassa.CancellationReasonExpiredOnCapture)...)
+	}
+	return notifications
+}
+
+func (s *Server) confirmationFor(paymentID string, confirmation yandexkassa.Confirmation) yandexkassa.ConfirmationResponse {
+	response := yandexkassa.ConfirmationResponse{
+		Type:      confirmation.Type,
+		Locale:    confirmation.Locale,
+		Enforce:   confirmation.Enforce,
+		ReturnUrl: confirmation.ReturnUrl}
+
+	switch confirmation.Type {
+	case yandexkassa.ConfirmationRedirect:
+		response.ConfirmationUrl = s.URL + "/checkout/payments/v2/contract?orderId=" + paymentID
+	case yandexkassa.ConfirmationMobileApplication:
+		response.ConfirmationUrl = "sberpay://invoicing/v2?bankInvoiceId=" + paymentID
+	case yandexkassa.ConfirmationEmbedded:
+		response.ConfirmationToken = "ct-" + paymentID
+	case yandexkassa.ConfirmationQR:
+		response.ConfirmationData = "https://qr.nspk.ru/" + paymentID
+	}
+	return response
+}
+
+func newMethod(id string, data yandexkassa.PaymentMethodData) yandexkassa.PaymentMethod {
+	common := yandexkassa.PaymentMethodCommon{ID: id}
+	if data == nil {
+		return &yandexkassa.BankCardMethod{PaymentMethodCommon: common}
+	}
+
+	switch d := data.(type) {
+	case *yandexkassa.BankCardData:
+		return bankCardMethod(common, d.Card)
+	case yandexkassa.BankCardData:
+		return bankCardMethod(common, d.Card)
+	case *yandexkassa.SberbankData:
+		return &yandexkassa.SberbankMethod{PaymentMethodCommon: common, Phone: d.Phone}
+	case *yandexkassa.AlfabankData:
+		return &yandexkassa.AlfabankMethod{PaymentMethodCommon: common, Login: d.Login}
+	case *yandexkassa.SbpData, yandexkassa.SbpData:
+		return &yandexkassa.SbpMethod{PaymentMethodCommon: common}
+	}
+
+	method, err := yandexkassa.DecodePaymentMethod([]byte(`{"type":"` + data.Type() + `","id":"` + id + `"}`))
+	if err != nil {
+		return &yandexkassa.UnknownPaymentMethod{PaymentMethodCommon: common, MethodType: data.Type()}
+	}
+	return method
+}
+
+func bankCardMethod(common yandexkassa.PaymentMethodCommon, card yandexkassa.Card) *yandexkassa.BankCardMethod {
+	method := &yandexkassa.BankCardMethod{PaymentMethodCommon: common}
+	if len(card.Number) >= 10 {
+		method.Card.First6 = card.Number[:6]
+		method.Card.Last4 = card.Number[len(card.Number)-4:]
+		method.Title = "Bank card *" + method.Card.Last4
+	}
+	method.Card.ExpiryYear = card.ExpiryYear
+	method.Card.ExpiryMonth = card.ExpiryMonth
+	method.Card.CardType = cardType(card.Number)
+	method.Card.IssuerCountry = "RU"
+	return method
+}
+
+//cardType определяет платежную систему по первой цифре номера карты
+func cardType(number string) string {
+	if number == "" {
+		return "Unknown"
+	}
+	switch number[0] {
+	case '4':
+		return "Visa"
+	case '5':
+		return "MasterCard"
+	case '2':
+		return "Mir"
+	}
+	return "Unknown"
+}
+
+func markSaved(method yandexkassa.PaymentMethod) yandexkassa.PaymentMethod {
+	data, err := json.Marshal(method)
+	if err != nil {
+		return method
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return method
+	}
+	fields["saved"] = true
+	fields["type"] = method.Type()
+	if data, err = json.Marshal(fields); err != nil {
+		return method
+	}
+	saved, err := yandexkassa.DecodePaymentMethod(data)
+	if err != nil {
+		return method
+	}
+	return saved
+}
+
+//copyPayment возвращает копию платежа, которая не разделяет с состоянием сервера ни одного поля:
+//ответы, уведомления и сценарии могут менять ее независимо
+func copyPayment(payment *yandexkassa.Payment) *yandexkassa.Payment {
+	copied := *payment
+	copied.Transfers = append([]yandexkassa.Transfer(nil), payment.Transfers...)
+	copied.PaymentMethod = copyMethod(payment.PaymentMethod)
+	if payment.Metadata != nil {
+		copied.Metadata = make(map[string]interface{}, len(payment.Metadata))
+		for key, value := range payment.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	if payment.CancellationDetails != nil {
+		details := *payment.CancellationDetails
+		copied.CancellationDetails = &details
+	}
+	if payment.AuthorizationDetails != nil {
+		details := *payment.AuthorizationDetails
+		copied.AuthorizationDetails = &details
+	}
+	if payment.Deal != nil {
+		deal := *payment.Deal
+		deal.Settlements = append([]yandexkassa.Settlement(nil), payment.Deal.Settlements...)
+		copied.Deal = &deal
+	}
+	return &copied
+}
+
+//copyMethod копирует способ оплаты через JSON, чтобы вложенные структуры (например, PayerBankDetails) не были общими
+func copyMethod(method yandexkassa.PaymentMethod) yandexkassa.PaymentMethod {
+	if method == nil {
+		return nil
+	}
+	data, err := json.Marshal(yandexkassa.Payment{PaymentMethod: method})
+	if err != nil {
+		return method
+	}
+	var payment yandexkassa.Payment
+	if err = json.Unmarshal(data, &payment); err != nil || payment.PaymentMethod == nil {
+		return method
+	}
+	return payment.PaymentMethod
+}
+
+//setTransferStatus переводит распределения платежа в статус самого платежа
+func setTransferStatus(payment *yandexkassa.Payment) {
+	for i := range payment.Transfers {
+		payment.Transfers[i].Status = payment.Status
+	}
+}
+
+//Advance сдвигает время сервера вперед на d, если Now не был заменен. Удобно для проверки отмены по истечении срока подтверждения
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	now := s.Now
+	s.Now = func() time.Time { return now().Add(d) }
+	notifications := s.expireLocked()
+	s.mu.Unlock()
+	s.deliver(notifications)
+}
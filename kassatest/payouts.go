@@ -0,0 +1,221 @@
+package kassatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"yandexkassa"
+)
+
+//Номер карты, выплата на который отменяется (как при отказе банка-получателя)
+const DeclinedPayoutCard = "4000000000000002"
+
+//Банки СБП, которые возвращает тестовый сервер
+var SbpBanks = []yandexkassa.SbpBank{
+	{BankID: "100000000111", Name: "Сбербанк", BIC: "044525225"},
+	{BankID: "100000000004", Name: "Тинькофф Банк", BIC: "044525974"},
+	{BankID: "100000000008", Name: "Альфа-Банк", BIC: "044525593"},
+}
+
+func (s *Server) createPayout(w http.ResponseWriter, body []byte) {
+	var request yandexkassa.PayoutRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+	amount, err := request.Amount.MinorUnits()
+	if err != nil || amount <= 0 {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.value", "Invalid amount value")
+		return
+	}
+	destination, parameter := payoutDestination(&request)
+	if parameter == "" && request.SelfEmployed != nil && (request.ReceiptData == nil || request.ReceiptData.ServiceName == "") {
+		parameter = "receipt_data.service_name"
+	}
+	if parameter != "" {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, parameter, "Invalid payout destination")
+		return
+	}
+
+	s.mu.Lock()
+	if request.Deal != nil {
+		deal, ok := s.deals[request.Deal.ID]
+		if !ok {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "deal.id", "Deal not found")
+			return
+		}
+		available, _ := deal.PayoutBalance.MinorUnits()
+		if deal.Status != yandexkassa.DealStatusOpened || amount > available {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.value",
+				"Payout amount exceeds the payout balance of the deal")
+			return
+		}
+		addToAmount(&deal.PayoutBalance, -amount)
+		addToAmount(&deal.Balance, -amount)
+	}
+
+	payout := &yandexkassa.Payout{
+		ID:                s.nextID("0b0e"),
+		Amount:            request.Amount,
+		Status:            yandexkassa.PayoutStatusPending,
+		PayoutDestination: destination,
+		Description:       request.Description,
+		CreatedAt:         s.now(),
+		Deal:              request.Deal,
+		Metadata:          request.Metadata,
+		SelfEmployed:      request.SelfEmployed,
+		ReceiptData:       request.ReceiptData,
+		Test:              true,
+	}
+	if destination.Type == yandexkassa.PayoutDestinationSbp {
+		payout.PayoutDestination.RecipientChecked = true
+	}
+	s.payouts[payout.ID] = payout
+	s.payoutOrder = append(s.payoutOrder, payout.ID)
+	response := *payout
+	declined := request.PayoutDestinationData != nil && request.PayoutDestinationData.Card != nil &&
+		request.PayoutDestinationData.Card.Number == DeclinedPayoutCard
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+	s.after(w, func() { s.finishPayout(payout.ID, declined) })
+}
+
+//finishPayout завершает выплату после ответа на запрос создания, как это происходит в Яндекс.Кассе
+func (s *Server) finishPayout(payoutID string, declined bool) {
+	s.mu.Lock()
+	payout := s.payouts[payoutID]
+	event := yandexkassa.EventPayoutSucceeded
+	payout.Status = yandexkassa.PayoutStatusSucceeded
+	if declined {
+		event = yandexkassa.EventPayoutCanceled
+		payout.Status = yandexkassa.PayoutStatusCanceled
+		payout.CancellationDetails = &yandexkassa.PayoutCancellationDetails{
+			Party:  yandexkassa.PayoutCancellationPartyPayoutNetwork,
+			Reason: yandexkassa.PayoutCancellationReasonRejectedByPayee}
+		if payout.Deal != nil {
+			if deal, ok := s.deals[payout.Deal.ID]; ok {
+				amount, _ := payout.Amount.MinorUnits()
+				addToAmount(&deal.PayoutBalance, amount)
+				addToAmount(&deal.Balance, amount)
+			}
+		}
+	}
+	response := *payout
+	s.mu.Unlock()
+
+	s.deliver([]pendingNotification{{event, &response}})
+}
+
+func (s *Server) getPayout(w http.ResponseWriter, payoutID string) {
+	s.mu.Lock()
+	payout, ok := s.payouts[payoutID]
+	var response yandexkassa.Payout
+	if ok {
+		response = *payout
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "payout_id", "Payout not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &response)
+}
+
+func (s *Server) listPayouts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var items []yandexkassa.Payout
+	for i := len(s.payoutOrder) - 1; i >= 0; i-- {
+		payout := s.payouts[s.payoutOrder[i]]
+		if typ := query.Get("payout_destination.type"); typ != "" && payout.PayoutDestination.Type != typ {
+			continue
+		}
+		if status := query.Get("status"); status != "" && payout.Status != status {
+			continue
+		}
+		ok, err := matchTime(r, "created_at", payout.CreatedAt)
+		if err != nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid filter value")
+			return
+		}
+		if ok {
+			items = append(items, *payout)
+		}
+	}
+	s.mu.Unlock()
+
+	from, to, nextCursor, err := listWindow(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid list parameter")
+		return
+	}
+	writeJSON(w, http.StatusOK, &yandexkassa.PayoutList{
+		Type:       "list",
+		Items:      append([]yandexkassa.Payout{}, items[from:to]...),
+		NextCursor: nextCursor})
+}
+
+func (s *Server) sbpBanks(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"type": "list", "items": SbpBanks})
+}
+
+//Payout возвращает копию выплаты
+func (s *Server) Payout(payoutID string) (*yandexkassa.Payout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payout, ok := s.payouts[payoutID]
+	if !ok {
+		return nil, false
+	}
+	copied := *payout
+	return &copied, true
+}
+
+//payoutDestination проверяет получателя выплаты и возвращает его в том виде, в каком он будет в ответе.
+//Если данные неверны, возвращается имя ошибочного параметра
+func payoutDestination(request *yandexkassa.PayoutRequest) (yandexkassa.PayoutDestination, string) {
+	if request.PayoutToken != "" {
+		return yandexkassa.PayoutDestination{
+			Type: yandexkassa.PayoutDestinationBankCard,
+			Card: &yandexkassa.PayoutCard{First6: "555555", Last4: "4477", CardType: "MasterCard"}}, ""
+	}
+	data := request.PayoutDestinationData
+	if data == nil {
+		return yandexkassa.PayoutDestination{}, "payout_destination_data"
+	}
+
+	switch data.Type {
+	case yandexkassa.PayoutDestinationBankCard:
+		if data.Card == nil || len(data.Card.Number) < 12 || strings.Trim(data.Card.Number, "0123456789") != "" {
+			return yandexkassa.PayoutDestination{}, "payout_destination_data.card.number"
+		}
+		number := data.Card.Number
+		return yandexkassa.PayoutDestination{
+			Type: data.Type,
+			Card: &yandexkassa.PayoutCard{First6: number[:6], Last4: number[len(number)-4:], CardType: cardType(number)}}, ""
+	case yandexkassa.PayoutDestinationSbp:
+		if len(data.Phone) < 11 || strings.Trim(data.Phone, "0123456789") != "" {
+			return yandexkassa.PayoutDestination{}, "payout_destination_data.phone"
+		}
+		for _, bank := range SbpBanks {
+			if bank.BankID == data.BankID {
+				return yandexkassa.PayoutDestination{Type: data.Type, Phone: data.Phone, BankID: data.BankID}, ""
+			}
+		}
+		return yandexkassa.PayoutDestination{}, "payout_destination_data.bank_id"
+	case yandexkassa.PayoutDestinationYooMoney:
+		if data.AccountNumber == "" {
+			return yandexkassa.PayoutDestination{}, "payout_destination_data.account_number"
+		}
+		return yandexkassa.PayoutDestination{Type: data.Type, AccountNumber: data.AccountNumber}, ""
+	default:
+		return yandexkassa.PayoutDestination{}, "payout_destination_data.type"
+	}
+}
@@ -0,0 +1,162 @@
+package kassatest_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+const fixtureCard = "5555555555554444"
+
+func fixturePayment() *yandexkassa.PaymentRequest {
+	return &yandexkassa.PaymentRequest{
+		Amount:      yandexkassa.Amount{Value: "100.00", Currency: "RUB"},
+		Description: "Order 1",
+		PaymentMethodData: yandexkassa.BankCardData{Card: yandexkassa.Card{
+			Number: fixtureCard, ExpiryYear: "2030", ExpiryMonth: "12", CSC: "123", Cardholder: "IVAN IVANOV"}},
+		Metadata: map[string]interface{}{"order_id": "1"}}
+}
+
+//Запись testdata/bank_card.json в тестовом магазине:
+//KASSA_SHOP_ID=... KASSA_SECRET_KEY=... go test ./kassatest -run TestRecordSandbox -record
+var recordSandbox = flag.Bool("record", false, "record testdata/bank_card.json against the Yandex.Kassa sandbox")
+
+//runFixture выполняет запросы, записанные в testdata/bank_card.json: платеж картой без 3-D Secure, его подтверждение и частичный возврат
+func runFixture(t *testing.T, kassa *yandexkassa.Kassa) {
+	t.Helper()
+	payment, _, err := kassa.WithIdempotenceKey("create-1").CreatePayment(fixturePayment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, ok := payment.PaymentMethod.(*yandexkassa.BankCardMethod)
+	if !ok || method.Card.Last4 != "4444" || method.Card.First6 != "555555" {
+		t.Fatalf("payment method decoded as %#v", payment.PaymentMethod)
+	}
+	if payment.Metadata["order_id"] != "1" {
+		t.Fatalf("metadata decoded as %v", payment.Metadata)
+	}
+
+	payment, _, err = kassa.PaymentInfo(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != yandexkassa.PaymentStatusWaitingForCapture || !payment.Paid {
+		t.Fatalf("payment is %s, paid %v", payment.Status, payment.Paid)
+	}
+	if _, err = payment.ExpiresTime(); err != nil {
+		t.Fatal(err)
+	}
+
+	payment, _, err = kassa.WithIdempotenceKey("capture-1").PaymentConfirm(payment.ID, &yandexkassa.PaymentRequest{
+		Amount: yandexkassa.Amount{Value: "100.00", Currency: "RUB"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != yandexkassa.PaymentStatusSucceeded {
+		t.Fatalf("captured payment is %s", payment.Status)
+	}
+	if _, err = payment.CapturedTime(); err != nil {
+		t.Fatal(err)
+	}
+
+	refund, _, err := kassa.WithIdempotenceKey("refund-1").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "40.00", Currency: "RUB"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refund, _, err = kassa.RefundInfo(refund.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.PaymentID != payment.ID || refund.Amount.Value != "40.00" || refund.Status != yandexkassa.RefundStatusSucceeded {
+		t.Fatalf("refund decoded as %+v", refund)
+	}
+}
+
+func TestReplayFixture(t *testing.T) {
+	rec, err := kassatest.NewRecorder("testdata/bank_card.json", kassatest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kassa := &yandexkassa.Kassa{ShopID: kassatest.DefaultShopID, SecretKey: "any", HTTPClient: rec.Client()}
+	runFixture(t, kassa)
+
+	//Ответ на этот запрос уже воспроизведен, повторять его Recorder не должен
+	if _, _, err = kassa.RefundInfo("216749f7-0016-50be-b000-078d43a63ae4"); err == nil {
+		t.Fatal("unrecorded request was answered")
+	}
+}
+
+func TestRecordSandbox(t *testing.T) {
+	if !*recordSandbox {
+		t.Skip("run with -record to record the fixture against the sandbox")
+	}
+	shopID, err := strconv.ParseInt(os.Getenv("KASSA_SHOP_ID"), 10, 64)
+	if err != nil || os.Getenv("KASSA_SECRET_KEY") == "" {
+		t.Fatal("KASSA_SHOP_ID and KASSA_SECRET_KEY of a test shop are required")
+	}
+	rec, err := kassatest.NewRecorder("testdata/bank_card.json", kassatest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFixture(t, &yandexkassa.Kassa{ShopID: shopID, SecretKey: os.Getenv("KASSA_SECRET_KEY"), HTTPClient: rec.Client()})
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordRedacts(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "kassatest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "fixture.json")
+
+	rec, err := kassatest.NewRecorder(file, kassatest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kassa := srv.Kassa()
+	kassa.HTTPClient = rec.Client()
+	if _, _, err = kassa.WithIdempotenceKey("create-1").CreatePayment(fixturePayment()); err != nil {
+		t.Fatal(err)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{fixtureCard, "IVAN IVANOV", srv.SecretKey} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("fixture contains %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), kassatest.Redacted) {
+		t.Error("fixture has no redacted fields")
+	}
+	if !strings.Contains(string(data), `"payment_token": ""`) {
+		t.Error("empty payment_token is redacted")
+	}
+
+	replay, err := kassatest.NewRecorder(file, kassatest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kassa.HTTPClient = replay.Client()
+	if _, _, err = kassa.WithIdempotenceKey("create-1").CreatePayment(fixturePayment()); err != nil {
+		t.Fatal(err)
+	}
+}
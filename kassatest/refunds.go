@@ -0,0 +1,126 @@
+package kassatest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"yandexkassa"
+)
+
+func (s *Server) createRefund(w http.ResponseWriter, body []byte) {
+	var request yandexkassa.RefundRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+	amount, err := request.Amount.MinorUnits()
+	if err != nil || amount <= 0 {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.value", "Invalid amount value")
+		return
+	}
+
+	s.mu.Lock()
+	payment, ok := s.payments[request.PaymentID]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "payment_id", "Payment not found")
+		return
+	}
+	if payment.Status != yandexkassa.PaymentStatusSucceeded {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "payment_id",
+			"Payment is in status "+payment.Status+" and can't be refunded")
+		return
+	}
+	if request.Amount.Currency != payment.Amount.Currency {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.currency", "Currency doesn't match the payment")
+		return
+	}
+	paid, _ := payment.Amount.MinorUnits()
+	refunded := int64(0)
+	if payment.RefundedAmount.Value != "" {
+		refunded, _ = payment.RefundedAmount.MinorUnits()
+	}
+	if refunded+amount > paid {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "amount.value",
+			"Refund amount exceeds the amount available for refund")
+		return
+	}
+
+	refund := &yandexkassa.Refund{
+		ID:          s.nextID("0015"),
+		PaymentID:   payment.ID,
+		Status:      yandexkassa.RefundStatusSucceeded,
+		CreatedAt:   s.now(),
+		Amount:      request.Amount,
+		Description: request.Description,
+		Sources:     append([]yandexkassa.RefundSource(nil), request.Sources...),
+	}
+	if payment.PaymentMethod != nil && payment.PaymentMethod.Type() == yandexkassa.PaymentMethodSbp {
+		refund.RefundMethod = &yandexkassa.RefundMethod{Type: yandexkassa.RefundMethodSbp, SbpOperationID: "sbp-" + refund.ID}
+	}
+	if payment.Deal != nil {
+		refund.Deal = &yandexkassa.RefundDeal{ID: payment.Deal.ID}
+		if request.Deal != nil {
+			refund.Deal.RefundSettlements = request.Deal.RefundSettlements
+		}
+		s.debitDealLocked(payment, refund)
+	}
+	s.refunds[refund.ID] = refund
+	s.refundOrder = append(s.refundOrder, refund.ID)
+	payment.RefundedAmount = yandexkassa.NewAmount(refunded+amount, payment.Amount.Currency)
+
+	response := *refund
+	notifications := []pendingNotification{{yandexkassa.EventRefundSucceeded, &response}}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &response)
+	s.deliverAfter(w, notifications)
+}
+
+func (s *Server) getRefund(w http.ResponseWriter, refundID string) {
+	refund, ok := s.Refund(refundID)
+	if !ok {
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "refund_id", "Refund not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, refund)
+}
+
+func (s *Server) listRefunds(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var items []yandexkassa.Refund
+	for i := len(s.refundOrder) - 1; i >= 0; i-- {
+		refund := s.refunds[s.refundOrder[i]]
+		if paymentID := query.Get("payment_id"); paymentID != "" && refund.PaymentID != paymentID {
+			continue
+		}
+		if status := query.Get("status"); status != "" && refund.Status != status {
+			continue
+		}
+		ok, err := matchTime(r, "created_at", refund.CreatedAt)
+		if err != nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid filter value")
+			return
+		}
+		if ok {
+			items = append(items, *refund)
+		}
+	}
+	s.mu.Unlock()
+
+	from, to, nextCursor, err := listWindow(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, err.Error(), "Invalid list parameter")
+		return
+	}
+	writeJSON(w, http.StatusOK, &yandexkassa.RefundList{
+		Type:       "list",
+		Items:      append([]yandexkassa.Refund{}, items[from:to]...),
+		NextCursor: nextCursor})
+}
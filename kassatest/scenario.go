@@ -0,0 +1,156 @@
+package kassatest
+
+import (
+	"net/http"
+	"strings"
+
+	"yandexkassa"
+)
+
+/*
+	Сценарии позволяют заранее задать, чем закончится платеж с определенным номером карты или значением в Metadata.
+	Платеж создается в статусе pending, а шаги сценария выполняются в фоне после того, как клиент получил ответ на запрос создания,
+	каждый со своим уведомлением на WebhookURL — так же, как их увидит обработчик Kassa.PaymentNotification.
+	Дождаться всех шагов можно вызовом Server.Flush.
+*/
+
+//Шаг сценария: переход платежа в новый статус
+type Step struct {
+	Status       string                          //Новый статус: waiting_for_capture, succeeded или canceled
+	Cancellation yandexkassa.CancellationDetails //Причина отмены для статуса canceled. Если Party не указан, он определяется по причине
+	Expire       bool                            //Для waiting_for_capture: срок подтверждения истекает сразу, и платеж отменяется с причиной expired_on_capture с уведомлением payment.canceled
+}
+
+//Authorize — пользователь подтвердил платеж. Если при создании указан Capture, платеж сразу переходит в succeeded
+func Authorize() Step {
+	return Step{Status: yandexkassa.PaymentStatusWaitingForCapture}
+}
+
+//Capture — платеж подтвержден магазином и перешел в succeeded
+func Capture() Step {
+	return Step{Status: yandexkassa.PaymentStatusSucceeded}
+}
+
+//Decline — платеж отменен с указанной причиной
+func Decline(reason yandexkassa.CancellationReason) Step {
+	return Step{
+		Status:       yandexkassa.PaymentStatusCanceled,
+		Cancellation: yandexkassa.CancellationDetails{Reason: reason}}
+}
+
+//ExpireOnCapture — пользователь подтвердил платеж, но магазин не успел его подтвердить до ExpiresAt
+func ExpireOnCapture() Step {
+	return Step{Status: yandexkassa.PaymentStatusWaitingForCapture, Expire: true}
+}
+
+type script struct {
+	cardPrefix    string
+	metadataKey   string
+	metadataValue string
+	steps         []Step
+}
+
+//ScriptCard задает шаги для платежей банковской картой, номер которой начинается с prefix
+func (s *Server) ScriptCard(prefix string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts = append(s.scripts, &script{cardPrefix: prefix, steps: steps})
+}
+
+//ScriptMetadata задает шаги для платежей, у которых в Metadata по ключу key записано value
+func (s *Server) ScriptMetadata(key, value string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts = append(s.scripts, &script{metadataKey: key, metadataValue: value, steps: steps})
+}
+
+//findScriptLocked возвращает шаги первого подходящего сценария. Сценарии проверяются в порядке добавления
+func (s *Server) findScriptLocked(request *yandexkassa.PaymentRequest) ([]Step, bool) {
+	var cardNumber string
+	switch data := request.PaymentMethodData.(type) {
+	case *yandexkassa.BankCardData:
+		cardNumber = data.Card.Number
+	case yandexkassa.BankCardData:
+		cardNumber = data.Card.Number
+	}
+
+	for _, sc := range s.scripts {
+		if sc.cardPrefix != "" && cardNumber != "" && strings.HasPrefix(cardNumber, sc.cardPrefix) {
+			return sc.steps, true
+		}
+		if sc.metadataKey != "" {
+			if value, ok := request.Metadata[sc.metadataKey]; ok && value == sc.metadataValue {
+				return sc.steps, true
+			}
+		}
+	}
+	return nil, false
+}
+
+//runScript ставит шаги сценария в очередь после ответа w. Уведомление шага отправляется до перехода к следующему шагу
+func (s *Server) runScript(w http.ResponseWriter, paymentID string, steps []Step) {
+	for _, step := range steps {
+		step := step
+		s.after(w, func() {
+			s.mu.Lock()
+			payment := s.payments[paymentID]
+			notifications := s.applyStepLocked(payment, step)
+			s.mu.Unlock()
+
+			s.send(notifications)
+		})
+	}
+}
+
+func (s *Server) applyStepLocked(payment *yandexkassa.Payment, step Step) []pendingNotification {
+	switch step.Status {
+	case yandexkassa.PaymentStatusWaitingForCapture:
+		if payment.Status != yandexkassa.PaymentStatusPending {
+			return nil
+		}
+		notifications := s.authorizeLocked(payment)
+		if step.Expire && payment.Status == yandexkassa.PaymentStatusWaitingForCapture {
+			notifications = append(notifications, s.cancelLocked(payment,
+				yandexkassa.CancellationPartyYandexCheckout, yandexkassa.CancellationReasonExpiredOnCapture)...)
+		}
+		return notifications
+
+	case yandexkassa.PaymentStatusSucceeded:
+		if payment.Status == yandexkassa.PaymentStatusPending {
+			payment.Paid = true
+			payment.Confirmation = yandexkassa.ConfirmationResponse{}
+		} else if payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+			return nil
+		}
+		return s.succeedLocked(payment)
+
+	case yandexkassa.PaymentStatusCanceled:
+		if payment.Status != yandexkassa.PaymentStatusPending && payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+			return nil
+		}
+		party := step.Cancellation.Party
+		if party == "" {
+			party = partyFor(step.Cancellation.Reason)
+		}
+		return s.cancelLocked(payment, party, step.Cancellation.Reason)
+	}
+	return nil
+}
+
+//partyFor возвращает участника, который обычно отменяет платеж по этой причине
+func partyFor(reason yandexkassa.CancellationReason) yandexkassa.CancellationParty {
+	switch reason {
+	case yandexkassa.CancellationReasonCanceledByMerchant:
+		return yandexkassa.CancellationPartyMerchant
+	case yandexkassa.CancellationReasonExpiredOnCapture,
+		yandexkassa.CancellationReasonExpiredOnConfirmation,
+		yandexkassa.CancellationReasonInternalTimeout,
+		yandexkassa.CancellationReasonFraudSuspected,
+		yandexkassa.CancellationReasonCountryForbidden,
+		yandexkassa.CancellationReasonIdentificationRequired,
+		yandexkassa.CancellationReasonPermissionRevoked:
+		return yandexkassa.CancellationPartyYandexCheckout
+	default:
+		return yandexkassa.CancellationPartyPaymentNetwork
+	}
+}
@@ -0,0 +1,97 @@
+package kassatest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//eventRecorder принимает уведомления сервера и запоминает их события по порядку
+type eventRecorder struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []string
+}
+
+func newEventRecorder(t *testing.T) *eventRecorder {
+	rec := &eventRecorder{}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification yandexkassa.Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+		}
+		rec.mu.Lock()
+		rec.events = append(rec.events, notification.Event)
+		rec.mu.Unlock()
+	}))
+	return rec
+}
+
+func (rec *eventRecorder) Events() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]string(nil), rec.events...)
+}
+
+func cardPayment(number string) *yandexkassa.PaymentRequest {
+	return &yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{Card: yandexkassa.Card{Number: number}}}
+}
+
+func TestScriptRunsAfterResponse(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	hook := newEventRecorder(t)
+	defer hook.Close()
+	srv.WebhookURL = hook.URL
+	srv.ScriptCard("5555", kassatest.Authorize(), kassatest.Capture())
+
+	payment, _, err := srv.Kassa().WithIdempotenceKey("order-1").CreatePayment(cardPayment("5555555555554444"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != yandexkassa.PaymentStatusPending {
+		t.Fatalf("create returned %s, want pending", payment.Status)
+	}
+	srv.Flush()
+
+	want := []string{yandexkassa.EventPaymentWaitingForCapture, yandexkassa.EventPaymentSucceeded}
+	if events := hook.Events(); !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	if stored, _ := srv.Payment(payment.ID); stored.Status != yandexkassa.PaymentStatusSucceeded {
+		t.Fatalf("payment is %s, want succeeded", stored.Status)
+	}
+}
+
+func TestScriptExpireOnCapture(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	hook := newEventRecorder(t)
+	defer hook.Close()
+	srv.WebhookURL = hook.URL
+	srv.ScriptCard("4111", kassatest.ExpireOnCapture())
+
+	payment, _, err := srv.Kassa().WithIdempotenceKey("order-1").CreatePayment(cardPayment("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+
+	want := []string{yandexkassa.EventPaymentWaitingForCapture, yandexkassa.EventPaymentCanceled}
+	if events := hook.Events(); !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	stored, _ := srv.Payment(payment.ID)
+	if stored.Status != yandexkassa.PaymentStatusCanceled || stored.CancellationDetails == nil ||
+		stored.CancellationDetails.Reason != yandexkassa.CancellationReasonExpiredOnCapture {
+		t.Fatalf("payment is %s with %+v, want canceled with expired_on_capture", stored.Status, stored.CancellationDetails)
+	}
+}
@@ -0,0 +1,652 @@
+/*
+	Пакет kassatest содержит тестовый сервер, который имитирует API Яндекс.Кассы (v3) в памяти процесса.
+	Сервер поддерживает создание, подтверждение, отмену и получение платежей, возвраты, безопасные сделки и выплаты, списки с фильтрами,
+	настройки магазина (GET /me), ключи идемпотентности, внедрение ошибок (429, 500, 202) и отправку уведомлений на заданный URL
+	и на адреса подписок /webhooks. Клиент, настроенный на сервер, возвращает Server.Kassa(), а клиент партнера с OAuth-токеном —
+	Server.PartnerKassa(); после теста сервер нужно остановить вызовом Close.
+	Уведомления отправляются в фоне после ответа на запрос, как в Яндекс.Кассе; дождаться их можно вызовом Flush.
+*/
+package kassatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yandexkassa"
+)
+
+const (
+	DefaultShopID     = 100500
+	DefaultSecretKey  = "test_secret_key"
+	DefaultOAuthToken = "test_oauth_token"
+
+	//Срок, в течение которого платеж в статусе waiting_for_capture можно подтвердить или отменить
+	DefaultCaptureTimeout = 7 * 24 * time.Hour
+)
+
+type Server struct {
+	*httptest.Server
+
+	ShopID            int64                //Идентификатор магазина, с которым сервер принимает запросы
+	SecretKey         string               //Секретный ключ, с которым сервер принимает запросы
+	PreviousSecretKey string               //Прежний ключ, который сервер еще принимает, как Яндекс.Касса во время смены ключа. Необязательно
+	OAuthToken        string               //OAuth-токен партнера, с которым сервер принимает запросы. Только с ним доступны /webhooks
+	WebhookURL        string               //Если указан, сервер отправляет на этот URL уведомления при смене статуса платежей и возвратов
+	CaptureTimeout    time.Duration        //Время до автоматической отмены платежа в статусе waiting_for_capture
+	Now               func() time.Time     //Текущее время сервера. Можно заменить, чтобы управлять временем в тестах
+	WebhookClient     *http.Client         //Клиент для отправки уведомлений
+	Account           *yandexkassa.Account //Ответ на GET /me. Если не указан, сервер возвращает включенный тестовый магазин ShopID
+
+	mu           sync.Mutex
+	seq          int
+	payments     map[string]*yandexkassa.Payment
+	paymentOrder []string
+	requests     map[string]*yandexkassa.PaymentRequest
+	refunds      map[string]*yandexkassa.Refund
+	refundOrder  []string
+	methods      map[string]yandexkassa.PaymentMethod
+	idempotence  map[string]*storedResponse
+	faults       []*Fault
+	scripts      []*script
+	webhookErrs  []error
+	deals        map[string]*yandexkassa.Deal
+	dealOrder    []string
+	payouts      map[string]*yandexkassa.Payout
+	payoutOrder  []string
+	webhooks     []yandexkassa.Webhook
+
+	queue    []func() //Уведомления и другие действия, которые выполняются после ответа на запрос
+	queueMu  sync.Mutex
+	queueSet *sync.Cond
+	busy     bool //Очередь выполняет действие
+	closed   bool
+	done     chan struct{}
+}
+
+//Ошибка, которую сервер вернет вместо обработки запроса
+type Fault struct {
+	Method     string //HTTP-метод запроса. Пустая строка — любой метод
+	Path       string //Префикс пути запроса без /v3, например /payments или /refunds. Пустая строка — любой путь
+	StatusCode int    //Код ответа: 202 (processing), 429, 500 и т.д.
+	Times      int    //Сколько запросов подряд завершить ошибкой. 0 — один запрос
+	RetryAfter int64  //Значение retry_after для ответа 202, в миллисекундах
+}
+
+type storedResponse struct {
+	request    string
+	statusCode int
+	body       []byte
+	ready      chan struct{} //Закрывается, когда ответ на первый запрос с этим ключом записан
+}
+
+//deferredWriter собирает действия, которые нужно выполнить после того, как ответ на запрос отправлен клиенту
+type deferredWriter struct {
+	http.ResponseWriter
+	jobs []func()
+}
+
+type pendingNotification struct {
+	event  string
+	object interface{}
+}
+
+//NewServer запускает тестовый сервер. Его нужно остановить вызовом Close
+func NewServer() *Server {
+	s := &Server{
+		ShopID:         DefaultShopID,
+		SecretKey:      DefaultSecretKey,
+		OAuthToken:     DefaultOAuthToken,
+		CaptureTimeout: DefaultCaptureTimeout,
+		Now:            time.Now,
+		WebhookClient:  &http.Client{Timeout: 10 * time.Second},
+		payments:       map[string]*yandexkassa.Payment{},
+		requests:       map[string]*yandexkassa.PaymentRequest{},
+		refunds:        map[string]*yandexkassa.Refund{},
+		methods:        map[string]yandexkassa.PaymentMethod{},
+		idempotence:    map[string]*storedResponse{},
+		deals:          map[string]*yandexkassa.Deal{},
+		payouts:        map[string]*yandexkassa.Payout{},
+		done:           make(chan struct{}),
+	}
+	s.queueSet = sync.NewCond(&s.queueMu)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	go s.work()
+	return s
+}
+
+//Close останавливает сервер, дождавшись отправки уведомлений из очереди
+func (s *Server) Close() {
+	s.Server.Close()
+	s.queueMu.Lock()
+	s.closed = true
+	s.queueSet.Broadcast()
+	s.queueMu.Unlock()
+	<-s.done
+}
+
+//Flush ждет, пока будут отправлены все уведомления и выполнены шаги сценариев, запланированные к этому моменту.
+//Уведомления отправляются по одному, поэтому Flush нельзя вызывать из обработчика уведомлений
+func (s *Server) Flush() {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	for len(s.queue) > 0 || s.busy {
+		s.queueSet.Wait()
+	}
+}
+
+//Kassa возвращает клиента, настроенного на этот сервер
+func (s *Server) Kassa() *yandexkassa.Kassa {
+	return &yandexkassa.Kassa{
+		ShopID:         s.ShopID,
+		SecretKey:      s.SecretKey,
+		IdempotenceKey: "kassatest",
+		BaseURL:        s.URL + "/v3"}
+}
+
+//PartnerKassa возвращает клиента, который авторизуется на сервере OAuth-токеном партнера
+func (s *Server) PartnerKassa() *yandexkassa.Kassa {
+	kassa := s.Kassa()
+	kassa.OAuthToken = s.OAuthToken
+	return kassa
+}
+
+//Inject добавляет ошибку, которую сервер вернет на подходящие запросы
+func (s *Server) Inject(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fault.Times <= 0 {
+		fault.Times = 1
+	}
+	s.faults = append(s.faults, &fault)
+}
+
+//Payment возвращает копию платежа, сохраненного на сервере
+func (s *Server) Payment(paymentID string) (*yandexkassa.Payment, bool) {
+	s.mu.Lock()
+	notifications := s.expireLocked()
+	payment, ok := s.payments[paymentID]
+	if ok {
+		payment = copyPayment(payment)
+	}
+	s.mu.Unlock()
+
+	s.deliver(notifications)
+	return payment, ok
+}
+
+//Refund возвращает копию возврата, сохраненного на сервере
+func (s *Server) Refund(refundID string) (*yandexkassa.Refund, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refund, ok := s.refunds[refundID]
+	if !ok {
+		return nil, false
+	}
+	copied := *refund
+	return &copied, true
+}
+
+//Confirm имитирует подтверждение платежа пользователем: платеж из статуса pending переходит
+//в waiting_for_capture (или сразу в succeeded, если при создании был указан Capture)
+func (s *Server) Confirm(paymentID string) error {
+	s.mu.Lock()
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("kassatest: payment %s not found", paymentID)
+	}
+	if payment.Status != yandexkassa.PaymentStatusPending {
+		s.mu.Unlock()
+		return fmt.Errorf("kassatest: payment %s is %s, not pending", paymentID, payment.Status)
+	}
+	notifications := s.authorizeLocked(payment)
+	s.mu.Unlock()
+
+	s.deliver(notifications)
+	return nil
+}
+
+//Cancel имитирует отмену платежа Яндекс.Кассой или платежной сетью с указанной причиной
+func (s *Server) Cancel(paymentID string, party yandexkassa.CancellationParty, reason yandexkassa.CancellationReason) error {
+	s.mu.Lock()
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("kassatest: payment %s not found", paymentID)
+	}
+	if payment.Status != yandexkassa.PaymentStatusPending && payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+		s.mu.Unlock()
+		return fmt.Errorf("kassatest: payment %s is %s and cannot be canceled", paymentID, payment.Status)
+	}
+	notifications := s.cancelLocked(payment, party, reason)
+	s.mu.Unlock()
+
+	s.deliver(notifications)
+	return nil
+}
+
+//Notify отправляет уведомление о событии event для объекта object (*yandexkassa.Payment или *yandexkassa.Refund) на url
+func (s *Server) Notify(url, event string, object interface{}) error {
+	notification, err := yandexkassa.NewNotification(event, object)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.WebhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kassatest: webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+//WebhookErrors возвращает ошибки отправки уведомлений на WebhookURL
+func (s *Server) WebhookErrors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.webhookErrs...)
+}
+
+//deliver ставит уведомления в очередь. Они отправляются по одному в порядке постановки, не задерживая ответ на запрос
+func (s *Server) deliver(notifications []pendingNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+	s.enqueue(func() { s.send(notifications) })
+}
+
+//deliverAfter ставит уведомления в очередь после того, как ответ w будет отправлен клиенту
+func (s *Server) deliverAfter(w http.ResponseWriter, notifications []pendingNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+	s.after(w, func() { s.send(notifications) })
+}
+
+//after ставит job в очередь после того, как ответ w будет отправлен клиенту. Вне обработки запроса job ставится в очередь сразу
+func (s *Server) after(w http.ResponseWriter, job func()) {
+	if d, ok := w.(*deferredWriter); ok {
+		d.jobs = append(d.jobs, job)
+		return
+	}
+	s.enqueue(job)
+}
+
+func (s *Server) enqueue(jobs ...func()) {
+	if len(jobs) == 0 {
+		return
+	}
+	s.queueMu.Lock()
+	s.queue = append(s.queue, jobs...)
+	s.queueSet.Broadcast()
+	s.queueMu.Unlock()
+}
+
+//work выполняет действия из очереди, пока сервер не остановлен и очередь не опустела
+func (s *Server) work() {
+	defer close(s.done)
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	for {
+		for len(s.queue) == 0 && !s.closed {
+			s.queueSet.Wait()
+		}
+		if len(s.queue) == 0 {
+			return
+		}
+		job := s.queue[0]
+		s.queue = s.queue[1:]
+		s.busy = true
+		s.queueMu.Unlock()
+		job()
+		s.queueMu.Lock()
+		s.busy = false
+		s.queueSet.Broadcast()
+	}
+}
+
+//send отправляет уведомления на WebhookURL и на адреса подписок, созданных через /webhooks
+func (s *Server) send(notifications []pendingNotification) {
+	for _, n := range notifications {
+		s.mu.Lock()
+		var urls []string
+		if s.WebhookURL != "" {
+			urls = append(urls, s.WebhookURL)
+		}
+		for _, webhook := range s.webhooks {
+			if webhook.Event == n.event {
+				urls = append(urls, webhook.URL)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, url := range urls {
+			if err := s.Notify(url, n.event, n.object); err != nil {
+				s.mu.Lock()
+				s.webhookErrs = append(s.webhookErrs, err)
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/v3/") {
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "", "Unknown endpoint")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v3")
+
+	partner := s.OAuthToken != "" && r.Header.Get("Authorization") == "Bearer "+s.OAuthToken
+	user, password, ok := r.BasicAuth()
+	validKey := password == s.SecretKey || (s.PreviousSecretKey != "" && password == s.PreviousSecretKey)
+	if !partner && (!ok || user != strconv.FormatInt(s.ShopID, 10) || !validKey) {
+		writeError(w, http.StatusUnauthorized, yandexkassa.ErrorInvalidCredentials, "", "Login or password is incorrect")
+		return
+	}
+	if strings.HasPrefix(path, "/webhooks") && !partner {
+		writeError(w, http.StatusForbidden, yandexkassa.ErrorForbidden, "", "Webhooks are available only with an OAuth token")
+		return
+	}
+
+	if s.injectFault(w, r.Method, path) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		deferred := &deferredWriter{ResponseWriter: w}
+		s.route(deferred, r, path, body)
+		s.finish(w, deferred.jobs)
+		return
+	}
+
+	key := r.Header.Get("Idempotence-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "Idempotence-Key", "Idempotence key is required")
+		return
+	}
+	request := r.Method + " " + path + " " + string(body)
+
+	//Пока первый запрос с ключом обрабатывается, ключ занят: повтор с тем же телом дождется его ответа, а не выполнится второй раз
+	s.mu.Lock()
+	stored, ok := s.idempotence[key]
+	if !ok {
+		stored = &storedResponse{request: request, ready: make(chan struct{})}
+		s.idempotence[key] = stored
+	}
+	s.mu.Unlock()
+	if ok {
+		if stored.request != request {
+			writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "Idempotence-Key", "Idempotence key duplicated")
+			return
+		}
+		<-stored.ready
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(stored.statusCode)
+		w.Write(stored.body)
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	deferred := &deferredWriter{ResponseWriter: recorder}
+	s.route(deferred, r, path, body)
+
+	s.mu.Lock()
+	stored.statusCode = recorder.Code
+	stored.body = recorder.Body.Bytes()
+	s.mu.Unlock()
+	close(stored.ready)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(recorder.Code)
+	w.Write(recorder.Body.Bytes())
+	s.finish(w, deferred.jobs)
+}
+
+//finish отправляет ответ клиенту и только после этого ставит в очередь действия, запланированные при обработке запроса
+func (s *Server) finish(w http.ResponseWriter, jobs []func()) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	s.enqueue(jobs...)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case parts[0] == "payments" && len(parts) == 1 && r.Method == http.MethodPost:
+		s.createPayment(w, body)
+	case parts[0] == "payments" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.listPayments(w, r)
+	case parts[0] == "payments" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.getPayment(w, parts[1])
+	case parts[0] == "payments" && len(parts) == 3 && parts[2] == "capture" && r.Method == http.MethodPost:
+		s.capturePayment(w, parts[1], body)
+	case parts[0] == "payments" && len(parts) == 3 && parts[2] == "cancel" && r.Method == http.MethodPost:
+		s.cancelPayment(w, parts[1])
+	case parts[0] == "refunds" && len(parts) == 1 && r.Method == http.MethodPost:
+		s.createRefund(w, body)
+	case parts[0] == "refunds" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.listRefunds(w, r)
+	case parts[0] == "refunds" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.getRefund(w, parts[1])
+	case parts[0] == "deals" && len(parts) == 1 && r.Method == http.MethodPost:
+		s.createDeal(w, body)
+	case parts[0] == "deals" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.listDeals(w, r)
+	case parts[0] == "deals" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.getDeal(w, parts[1])
+	case parts[0] == "payouts" && len(parts) == 1 && r.Method == http.MethodPost:
+		s.createPayout(w, body)
+	case parts[0] == "payouts" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.listPayouts(w, r)
+	case parts[0] == "payouts" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.getPayout(w, parts[1])
+	case parts[0] == "sbp_banks" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.sbpBanks(w)
+	case parts[0] == "webhooks" && len(parts) == 1 && r.Method == http.MethodPost:
+		s.createWebhook(w, body)
+	case parts[0] == "webhooks" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.listWebhooks(w)
+	case parts[0] == "webhooks" && len(parts) == 2 && r.Method == http.MethodDelete:
+		s.deleteWebhook(w, parts[1])
+	case parts[0] == "me" && len(parts) == 1 && r.Method == http.MethodGet:
+		s.me(w)
+	default:
+		writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "", "Unknown endpoint")
+	}
+}
+
+func (s *Server) me(w http.ResponseWriter) {
+	if s.Account != nil {
+		writeJSON(w, http.StatusOK, s.Account)
+		return
+	}
+	writeJSON(w, http.StatusOK, &yandexkassa.Account{
+		AccountID:     strconv.FormatInt(s.ShopID, 10),
+		Status:        yandexkassa.AccountStatusEnabled,
+		Test:          true,
+		Fiscalization: &yandexkassa.Fiscalization{},
+		PaymentMethods: []string{yandexkassa.PaymentMethodBankCard, yandexkassa.PaymentMethodYandexMoney,
+			yandexkassa.PaymentMethodSberbank, yandexkassa.PaymentMethodSbp}})
+}
+
+func (s *Server) injectFault(w http.ResponseWriter, method, path string) bool {
+	s.mu.Lock()
+	var fault *Fault
+	for i, f := range s.faults {
+		if (f.Method == "" || f.Method == method) && strings.HasPrefix(path, f.Path) {
+			fault = f
+			f.Times--
+			if f.Times <= 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if fault == nil {
+		return false
+	}
+
+	if fault.StatusCode == http.StatusAccepted {
+		retryAfter := fault.RetryAfter
+		if retryAfter == 0 {
+			retryAfter = 1800
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"type":        "processing",
+			"description": "Request accepted, but not processed yet",
+			"retry_after": retryAfter})
+		return true
+	}
+
+	code := yandexkassa.ErrorInternalServerError
+	switch fault.StatusCode {
+	case http.StatusBadRequest:
+		code = yandexkassa.ErrorInvalidRequest
+	case http.StatusUnauthorized:
+		code = yandexkassa.ErrorInvalidCredentials
+	case http.StatusForbidden:
+		code = yandexkassa.ErrorForbidden
+	case http.StatusNotFound:
+		code = yandexkassa.ErrorNotFound
+	case http.StatusTooManyRequests:
+		code = yandexkassa.ErrorTooManyRequests
+	}
+	writeError(w, fault.StatusCode, code, "", "Injected error")
+	return true
+}
+
+func (s *Server) nextID(kind string) string {
+	s.seq++
+	return fmt.Sprintf("%08x-%s-5000-9000-%012x", s.seq, kind, s.seq)
+}
+
+func (s *Server) now() string {
+	return yandexkassa.FormatTime(s.Now())
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		body = []byte(`{"type":"error","code":"internal_server_error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+var errorSeq struct {
+	sync.Mutex
+	n int
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code, parameter, description string) {
+	errorSeq.Lock()
+	errorSeq.n++
+	id := fmt.Sprintf("%08x-0000-4000-8000-%012x", errorSeq.n, errorSeq.n)
+	errorSeq.Unlock()
+
+	writeJSON(w, statusCode, &yandexkassa.Error{
+		Type:        "error",
+		ID:          id,
+		Code:        code,
+		Description: description,
+		Parameter:   parameter})
+}
+
+func listWindow(r *http.Request, total int) (int, int, string, error) {
+	query := r.URL.Query()
+	limit := 10
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return 0, 0, "", fmt.Errorf("limit")
+		}
+		limit = parsed
+	}
+	offset := 0
+	if value := query.Get("cursor"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, "", fmt.Errorf("cursor")
+		}
+		offset = parsed
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	nextCursor := ""
+	if end < total {
+		nextCursor = strconv.Itoa(end)
+	} else {
+		end = total
+	}
+	return offset, end, nextCursor, nil
+}
+
+//matchTime проверяет время created по фильтрам prefix.gte, prefix.gt, prefix.lte, prefix.lt из запроса
+func matchTime(r *http.Request, prefix, created string) (bool, error) {
+	query := r.URL.Query()
+	operators := []string{"gte", "gt", "lte", "lt"}
+	for _, operator := range operators {
+		value := query.Get(prefix + "." + operator)
+		if value == "" {
+			continue
+		}
+		bound, err := yandexkassa.ParseTime(value)
+		if err != nil {
+			return false, fmt.Errorf("%s.%s", prefix, operator)
+		}
+		t, err := yandexkassa.ParseTime(created)
+		if err != nil || t.IsZero() {
+			return false, nil
+		}
+		switch operator {
+		case "gte":
+			if t.Before(bound) {
+				return false, nil
+			}
+		case "gt":
+			if !t.After(bound) {
+				return false, nil
+			}
+		case "lte":
+			if t.After(bound) {
+				return false, nil
+			}
+		case "lt":
+			if !t.Before(bound) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package kassatest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func paymentRequest(value string) *yandexkassa.PaymentRequest {
+	return &yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: value, Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}}
+}
+
+func TestIdempotenceReplay(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa().WithIdempotenceKey("order-1")
+
+	first, _, err := kassa.CreatePayment(paymentRequest("10.00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := kassa.CreatePayment(paymentRequest("10.00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID {
+		t.Fatalf("replay created a new payment: %s, %s", first.ID, second.ID)
+	}
+}
+
+func TestIdempotenceConflict(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa().WithIdempotenceKey("order-1")
+
+	if _, _, err := kassa.CreatePayment(paymentRequest("10.00")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := kassa.CreatePayment(paymentRequest("20.00"))
+	apiErr, ok := yandexkassa.IsYandexError(err)
+	if !ok || apiErr.Code != yandexkassa.ErrorInvalidRequest {
+		t.Fatalf("got %v, want invalid_request", err)
+	}
+}
+
+func TestIdempotenceConcurrent(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa().WithIdempotenceKey("order-1")
+
+	const n = 10
+	ids := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payment, _, err := kassa.CreatePayment(paymentRequest("10.00"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = payment.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Fatalf("concurrent requests with one key created different payments: %v", ids)
+		}
+	}
+	list, _, err := srv.Kassa().ListPayments(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d payments, want 1", len(list.Items))
+	}
+}
+
+func TestWebhookAfterResponse(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+
+	payment, _, err := kassa.WithIdempotenceKey("create").CreatePayment(paymentRequest("10.00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	captured := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-captured:
+		case <-time.After(5 * time.Second):
+			t.Error("notification was sent before the response")
+		}
+		var notification yandexkassa.Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		events = append(events, notification.Event)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	srv.Flush()
+	srv.WebhookURL = hook.URL
+
+	if _, _, err = kassa.WithIdempotenceKey("capture").PaymentConfirm(payment.ID, paymentRequest("10.00")); err != nil {
+		t.Fatal(err)
+	}
+	close(captured)
+	srv.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0] != yandexkassa.EventPaymentSucceeded {
+		t.Fatalf("got events %v, want [%s]", events, yandexkassa.EventPaymentSucceeded)
+	}
+	if errs := srv.WebhookErrors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestPaymentCopyIsDeep(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	srv.ScriptCard("4111", kassatest.Decline(yandexkassa.CancellationReasonInsufficientFunds))
+
+	request := paymentRequest("10.00")
+	request.PaymentMethodData = yandexkassa.BankCardData{Card: yandexkassa.Card{Number: "4111111111111111"}}
+	request.Metadata = map[string]interface{}{"order_id": "1"}
+	payment, _, err := srv.Kassa().WithIdempotenceKey("order-1").CreatePayment(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+
+	stored, _ := srv.Payment(payment.ID)
+	stored.Metadata["order_id"] = "2"
+	stored.CancellationDetails.Reason = yandexkassa.CancellationReasonGeneralDecline
+	stored.PaymentMethod.(*yandexkassa.BankCardMethod).Card.Last4 = "0000"
+
+	again, _ := srv.Payment(payment.ID)
+	if again.Metadata["order_id"] != "1" {
+		t.Errorf("metadata is shared with the server: %v", again.Metadata)
+	}
+	if again.CancellationDetails.Reason != yandexkassa.CancellationReasonInsufficientFunds {
+		t.Errorf("cancellation details are shared with the server: %+v", again.CancellationDetails)
+	}
+	if again.PaymentMethod.(*yandexkassa.BankCardMethod).Card.Last4 != "1111" {
+		t.Errorf("payment method is shared with the server: %+v", again.PaymentMethod)
+	}
+}
@@ -0,0 +1,72 @@
+package kassatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"yandexkassa"
+)
+
+func (s *Server) createWebhook(w http.ResponseWriter, body []byte) {
+	var request yandexkassa.WebhookRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "", err.Error())
+		return
+	}
+	switch request.Event {
+	case yandexkassa.EventPaymentWaitingForCapture, yandexkassa.EventPaymentSucceeded, yandexkassa.EventPaymentCanceled,
+		yandexkassa.EventRefundSucceeded, yandexkassa.EventDealClosed, yandexkassa.EventPayoutSucceeded, yandexkassa.EventPayoutCanceled:
+	default:
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "event", "Unknown event")
+		return
+	}
+	if parsed, err := url.Parse(request.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		writeError(w, http.StatusBadRequest, yandexkassa.ErrorInvalidRequest, "url", "Invalid webhook URL")
+		return
+	}
+
+	s.mu.Lock()
+	for _, webhook := range s.webhooks {
+		if webhook.Event == request.Event && webhook.URL == request.URL {
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, &webhook)
+			return
+		}
+	}
+	webhook := yandexkassa.Webhook{ID: "wh-" + s.nextID("0e0b"), Event: request.Event, URL: request.URL}
+	s.webhooks = append(s.webhooks, webhook)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &webhook)
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter) {
+	s.mu.Lock()
+	items := append([]yandexkassa.Webhook{}, s.webhooks...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &yandexkassa.WebhookList{Type: "list", Items: items})
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, webhookID string) {
+	s.mu.Lock()
+	for i, webhook := range s.webhooks {
+		if webhook.ID == webhookID {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, map[string]interface{}{})
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	writeError(w, http.StatusNotFound, yandexkassa.ErrorNotFound, "webhook_id", "Webhook not found")
+}
+
+//Webhooks возвращает подписки на уведомления, созданные через API
+func (s *Server) Webhooks() []yandexkassa.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]yandexkassa.Webhook(nil), s.webhooks...)
+}
@@ -0,0 +1,90 @@
+package yandexkassa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+/*
+	Настройки магазина (GET /me). Запрос не меняет данных, поэтому его удобно выполнять при запуске сервиса:
+	HealthCheck проверяет, что ShopID и SecretKey верны, магазин включен и ответ пришел именно для ShopID.
+	Тестовый это магазин или рабочий, показывает поле Account.Test.
+*/
+
+const (
+	AccountStatusEnabled  = "enabled"  //Магазин принимает платежи
+	AccountStatusDisabled = "disabled" //Магазин отключен
+)
+
+var (
+	ErrAccountDisabled = errors.New("yandexkassa: account is disabled")
+	ErrAccountMismatch = errors.New("yandexkassa: account_id in the response does not match ShopID")
+)
+
+//Настройки магазина или шлюза
+type Account struct {
+	AccountID      string         `json:"account_id"`                //Идентификатор магазина или шлюза
+	Status         string         `json:"status"`                    //Статус магазина: enabled или disabled
+	Test           bool           `json:"test"`                      //Тестовый магазин
+	Fiscalization  *Fiscalization `json:"fiscalization,omitempty"`   //Настройки отправки чеков
+	PaymentMethods []string       `json:"payment_methods,omitempty"` //Способы оплаты, доступные магазину
+	ITN            string         `json:"itn,omitempty"`             //ИНН организации
+	PayoutMethods  []string       `json:"payout_methods,omitempty"`  //Способы выплат, доступные шлюзу
+	Name           string         `json:"name,omitempty"`            //Название шлюза
+	PayoutBalance  *Amount        `json:"payout_balance,omitempty"`  //Баланс шлюза для выплат
+
+	FiscalizationEnabled bool `json:"fiscalization_enabled"` //Устаревшее поле, используйте Fiscalization.Enabled
+}
+
+//Настройки отправки чеков
+type Fiscalization struct {
+	Enabled  bool   `json:"enabled"`            //Магазин отправляет чеки через Яндекс.Кассу
+	Provider string `json:"provider,omitempty"` //Онлайн-касса, через которую отправляются чеки, например atol
+}
+
+//HasPaymentMethod проверяет, что способ оплаты (например PaymentMethodSbp) доступен магазину
+func (a *Account) HasPaymentMethod(method string) bool {
+	for _, m := range a.PaymentMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+//Me возвращает настройки магазина, от имени которого выполняются запросы
+func (k *Kassa) Me(ctx context.Context) (*Account, *Processing, error) {
+	var account Account
+	processing, err := k.doContext(ctx, http.MethodGet, "/me", nil, &account)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &account, nil, nil
+}
+
+//HealthCheck проверяет данные магазина запросом Me. Ошибка возвращается, если ключ неверен (*Error с кодом invalid_credentials),
+//магазин отключен (ErrAccountDisabled) или ответ пришел не для ShopID (ErrAccountMismatch; с OAuth-токеном без ShopID не проверяется).
+//Вместе с ErrAccountDisabled и ErrAccountMismatch возвращаются и сами настройки
+func (k *Kassa) HealthCheck(ctx context.Context) (*Account, error) {
+	account, processing, err := k.Me(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if processing != nil {
+		return nil, fmt.Errorf("yandexkassa: request is processing, retry after %d ms", processing.RetryAfter)
+	}
+	credentials, err := k.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if credentials.ShopID != 0 && account.AccountID != strconv.FormatInt(credentials.ShopID, 10) {
+		return account, ErrAccountMismatch
+	}
+	if account.Status != AccountStatusEnabled {
+		return account, ErrAccountDisabled
+	}
+	return account, nil
+}
@@ -0,0 +1,140 @@
+package yandexkassa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/*
+	Уведомления (webhooks), которые Яндекс.Касса отправляет на ваш URL при смене статуса объекта.
+	Тело уведомления содержит тип события (event) и сам объект (object) в том же виде, что и в ответах API.
+*/
+
+const NotificationType = "notification"
+
+const (
+	EventPaymentWaitingForCapture = "payment.waiting_for_capture"
+	EventPaymentSucceeded         = "payment.succeeded"
+	EventPaymentCanceled          = "payment.canceled"
+	EventRefundSucceeded          = "refund.succeeded"
+	EventDealClosed               = "deal.closed"
+	EventPayoutSucceeded          = "payout.succeeded"
+	EventPayoutCanceled           = "payout.canceled"
+)
+
+type Notification struct {
+	Type   string          `json:"type"`   //Тип объекта, всегда notification
+	Event  string          `json:"event"`  //Событие, о котором уведомляет Яндекс.Касса (например: payment.succeeded)
+	Object json.RawMessage `json:"object"` //Объект, с которым произошло событие (Payment, Refund, Deal или Payout)
+}
+
+//NewNotification создает уведомление о событии event для объекта object (например, *Payment или *Refund)
+func NewNotification(event string, object interface{}) (*Notification, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return &Notification{Type: NotificationType, Event: event, Object: data}, nil
+}
+
+//Payment возвращает платеж из уведомления о событии payment.*
+func (n *Notification) Payment() (*Payment, error) {
+	var payment Payment
+	if err := json.Unmarshal(n.Object, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+//Refund возвращает возврат из уведомления о событии refund.*
+func (n *Notification) Refund() (*Refund, error) {
+	var refund Refund
+	if err := json.Unmarshal(n.Object, &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+//Deal возвращает сделку из уведомления о событии deal.*
+func (n *Notification) Deal() (*Deal, error) {
+	var deal Deal
+	if err := json.Unmarshal(n.Object, &deal); err != nil {
+		return nil, err
+	}
+	return &deal, nil
+}
+
+//Payout возвращает выплату из уведомления о событии payout.*
+func (n *Notification) Payout() (*Payout, error) {
+	var payout Payout
+	if err := json.Unmarshal(n.Object, &payout); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+//DealNotification возвращает обработчик уведомлений по безопасным сделкам: closedFunction вызывается для deal.closed,
+//payoutFunction — для payout.succeeded и payout.canceled. Уведомления о других событиях принимаются без обработки.
+//Если функция вернула ошибку, обработчик отвечает 500, и Яндекс.Касса повторит уведомление
+func (k *Kassa) DealNotification(closedFunction func(*Kassa, *Deal) error, payoutFunction func(*Kassa, *Payout) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, q *http.Request) {
+		body, err := ioutil.ReadAll(q.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var notification Notification
+		if err = json.Unmarshal(body, &notification); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch notification.Event {
+		case EventDealClosed:
+			var deal *Deal
+			if deal, err = notification.Deal(); err == nil && closedFunction != nil {
+				err = closedFunction(k, deal)
+			}
+		case EventPayoutSucceeded, EventPayoutCanceled:
+			var payout *Payout
+			if payout, err = notification.Payout(); err == nil && payoutFunction != nil {
+				err = payoutFunction(k, payout)
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+//decodeNotification разбирает тело уведомления о платеже или возврате. Кроме уведомления с полями type/event/object
+//принимается и платеж без обертки. Для уведомлений о других объектах (например, deal.closed) оба результата nil
+func decodeNotification(data []byte) (*Payment, *Refund, error) {
+	var notification Notification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, nil, err
+	}
+	if notification.Type != NotificationType {
+		var payment Payment
+		if err := json.Unmarshal(data, &payment); err != nil {
+			return nil, nil, err
+		}
+		return &payment, nil, nil
+	}
+	payment := strings.HasPrefix(notification.Event, "payment.")
+	if !payment && !strings.HasPrefix(notification.Event, "refund.") {
+		return nil, nil, nil
+	}
+	if isEmptyJSON(notification.Object) {
+		return nil, nil, fmt.Errorf("yandexkassa: notification %s has no object", notification.Event)
+	}
+	if payment {
+		p, err := notification.Payment()
+		return p, nil, err
+	}
+	r, err := notification.Refund()
+	return nil, r, err
+}
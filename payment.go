@@ -1,11 +1,12 @@
 package yandexkassa
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 /*
@@ -25,80 +26,345 @@ const (
 	PaymentMethodApplePay      = "apple_pay"
 	PaymentMethodMobileBalance = "mobile_balance"
 	PaymentMethodInstallments  = "installments"
+	PaymentMethodSbp           = "sbp"
+)
+
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusWaitingForCapture = "waiting_for_capture"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusCanceled          = "canceled"
 )
 
 type PaymentRequest struct {
-	Amount            Amount                 `json:"amount"`              //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму.
-	Description       string                 `json:"description"`         //Описание транзакции, которое вы увидите в личном кабинете Яндекс.Кассы, а пользователь — при оплате. Например: «Оплата заказа № 72 для user@yandex.ru».
-	Receipt           Receipt                `json:"receipt"`             //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
-	Recipient         Recipient              `json:"recipient"`           //Получатель платежа. Нужен, если вы разделяете потоки платежей в рамках одного аккаунта или создаете платеж в адрес другого аккаунта
-	PaymentToken      string                 `json:"payment_token"`       //Одноразовый токен для проведения оплаты, сформированный виджетом Yandex.Checkout.js
-	PaymentMethodId   string                 `json:"payment_method_id"`   //Идентификатор сохраненного способа оплаты
-	PaymentMethodData PaymentMethodData      `json:"payment_method_data"` //Данные, необходимые для создания способа оплаты (payment_method), которым будет платить пользователь
-	Confirmation      Confirmation           `json:"confirmation"`        //Данные, необходимые для инициации выбранного сценария подтверждения платежа пользователем
-	SavePaymentMethod bool                   `json:"save_payment_method"` //Сохранение платежных данных (с их помощью можно проводить повторные безакцептные списания). Значение true инициирует создание многоразового payment_method
-	Capture           bool                   `json:"capture"`             //Автоматический прием поступившего платежа
-	ClientIp          string                 `json:"client_ip"`           //IPv4 или IPv6-адрес пользователя. Если не указан, используется IP-адрес TCP-подключения
-	Metadata          map[string]interface{} `json:"metadata"`            //Любые дополнительные данные, которые нужны вам для работы с платежами (например, номер заказа). Передаются в виде набора пар «ключ-значение» и возвращаются в ответе от Яндекс.Кассы. Ограничения: максимум 16 ключей, имя ключа не больше 32 символов, значение ключа не больше 512 символов
-	Airline           Airline                `json:"airline"`             //Объект с данными для продажи авиабилетов. Используется только для платежей банковской картой
+	Amount            Amount                 `json:"amount"`                        //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму.
+	Description       string                 `json:"description"`                   //Описание транзакции, которое вы увидите в личном кабинете Яндекс.Кассы, а пользователь — при оплате. Например: «Оплата заказа № 72 для user@yandex.ru».
+	Receipt           Receipt                `json:"receipt"`                       //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
+	Recipient         Recipient              `json:"recipient"`                     //Получатель платежа. Нужен, если вы разделяете потоки платежей в рамках одного аккаунта или создаете платеж в адрес другого аккаунта
+	PaymentToken      string                 `json:"payment_token"`                 //Одноразовый токен для проведения оплаты, сформированный виджетом Yandex.Checkout.js
+	PaymentMethodId   string                 `json:"payment_method_id"`             //Идентификатор сохраненного способа оплаты
+	PaymentMethodData PaymentMethodData      `json:"payment_method_data,omitempty"` //Данные, необходимые для создания способа оплаты (payment_method), которым будет платить пользователь
+	Confirmation      Confirmation           `json:"confirmation"`                  //Данные, необходимые для инициации выбранного сценария подтверждения платежа пользователем
+	SavePaymentMethod bool                   `json:"save_payment_method"`           //Сохранение платежных данных (с их помощью можно проводить повторные безакцептные списания). Значение true инициирует создание многоразового payment_method
+	Capture           bool                   `json:"capture"`                       //Автоматический прием поступившего платежа
+	ClientIp          string                 `json:"client_ip"`                     //IPv4 или IPv6-адрес пользователя. Если не указан, используется IP-адрес TCP-подключения
+	Metadata          map[string]interface{} `json:"metadata"`                      //Любые дополнительные данные, которые нужны вам для работы с платежами (например, номер заказа). Передаются в виде набора пар «ключ-значение» и возвращаются в ответе от Яндекс.Кассы. Ограничения: максимум 16 ключей, имя ключа не больше 32 символов, значение ключа не больше 512 символов
+	Airline           Airline                `json:"airline"`                       //Объект с данными для продажи авиабилетов. Используется только для платежей банковской картой
+	Transfers         []Transfer             `json:"transfers,omitempty"`           //Распределение денег между магазинами-продавцами (для маркетплейсов). Сумма переводов должна быть равна Amount
+	Deal              *PaymentDeal           `json:"deal,omitempty"`                //Безопасная сделка, к которой относится платеж
 }
 
 /*
 	Подтверждает вашу готовность принять платеж. Платеж можно подтвердить, только если он находится в статусе waiting_for_capture.
 	Если платеж подтвержден успешно — значит, оплата прошла, и вы можете выдать товар или оказать услугу пользователю
 */
+type CaptureRequest struct {
+	Amount    *Amount    `json:"amount,omitempty"`    //Сумма к подтверждению. Если не указана, подтверждается вся сумма платежа. Может быть меньше суммы платежа — тогда остаток вернется пользователю
+	Receipt   *Receipt   `json:"receipt,omitempty"`   //Чек для онлайн-кассы (54-ФЗ). При частичном подтверждении в нем должны быть только переданные пользователю товары на сумму Amount
+	Airline   *Airline   `json:"airline,omitempty"`   //Объект с данными для продажи авиабилетов. Используется только для платежей банковской картой
+	Transfers []Transfer `json:"transfers,omitempty"` //Распределение подтверждаемой суммы между магазинами-продавцами. Нужно при частичном подтверждении платежа с переводами
+}
+
+//Оставлено для совместимости, используйте CaptureRequest. Поля здесь — значения, а не указатели, как в CaptureRequest;
+//пустые поля при подтверждении не передаются (см. CaptureRequest)
 type PaymentConfirmRequest struct {
-	Amount  Amount  `json: "amount"`  //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму.
-	Receipt Receipt `json: "receipt"` //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
-	Airline Airline `json: "airline"` //Объект с данными для продажи авиабилетов. Используется только для платежей банковской картой
+	Amount  Amount  `json:"amount"`  //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму.
+	Receipt Receipt `json:"receipt"` //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
+	Airline Airline `json:"airline"` //Объект с данными для продажи авиабилетов. Используется только для платежей банковской картой
+}
+
+//CaptureRequest возвращает запрос подтверждения, в котором указаны только непустые поля
+func (r *PaymentConfirmRequest) CaptureRequest() *CaptureRequest {
+	capture := &CaptureRequest{}
+	if r.Amount.Value != "" {
+		amount := r.Amount
+		capture.Amount = &amount
+	}
+	if len(r.Receipt.Items) > 0 {
+		receipt := r.Receipt
+		capture.Receipt = &receipt
+	}
+	if r.Airline.TicketNumber != "" || r.Airline.BookingReference != "" {
+		airline := r.Airline
+		capture.Airline = &airline
+	}
+	return capture
 }
 
 type Payment struct {
-	ID                  string                 `json:"id"`                   //Идентификатор платежа
-	Status              string                 `json:"status"`               //Статус платежа. Возможные значения: pending, waiting_for_capture, succeeded и canceled
-	Amount              Amount                 `json:"amount"`               //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму
-	Description         string                 `json:"description"`          //Описание транзакции, которое вы увидите в личном кабинете Яндекс.Кассы, а пользователь — при оплате. Например: «Оплата заказа № 72 для user@yandex.ru»
-	Recipient           Recipient              `json:"recipient"`            //Получатель платежа. Нужен, если вы разделяете потоки платежей в рамках одного аккаунта или создаете платеж в адрес другого аккаунта
-	PaymentMethod       PaymentMethod          `json:"payment_method"`       //Способ оплаты, который был использован для этого платежа
-	CapturedAt          string                 `json:"captured_at"`          //Время подтверждения платежа. Указывается по UTC и передается в формате ISO 8601
-	CreatedAt           string                 `json:"created_at"`           //Время создания заказа. Указывается по UTC и передается в формате ISO 8601. Пример: 2017-11-03T11:52:31.827Z
-	ExpiresAt           string                 `json:"expires_at"`           //Время, до которого вы можете бесплатно отменить или подтвердить платеж. В указанное время платеж в статусе waiting_for_capture будет автоматически отменен. Указывается по UTC и передается в формате ISO 8601. Пример: 2017-11-03T11:52:31.827Z
-	Confirmation        ConfirmationResponse   `json:"confirmation"`         //Выбранный способ подтверждения платежа. Присутствует, когда платеж ожидает подтверждения от пользователя
-	Test                bool                   `json:"test"`                 //Признак тестовой операции
-	RefundedAmount      Amount                 `json:"refunded_amount"`      //Сумма, которая вернулась пользователю. Присутствует, если у этого платежа есть успешные возвраты
-	Paid                bool                   `json:"paid"`                 //Признак оплаты заказа
-	ReceiptRegistration string                 `json:"receipt_registration"` //Статус доставки данных для чека в онлайн-кассу (pending, succeeded или canceled). Присутствует, если вы используете решение Яндекс.Кассы для работы по 54-ФЗ
-	Metadata            map[string]interface{} `json:"metadata"`             //Любые дополнительные данные, которые нужны вам для работы с платежами (например, номер заказа). Передаются в виде набора пар «ключ-значение» и возвращаются в ответе от Яндекс.Кассы. Ограничения: максимум 16 ключей, имя ключа не больше 32 символов, значение ключа не больше 512 символов
+	ID                   string                 `json:"id"`                              //Идентификатор платежа
+	Status               string                 `json:"status"`                          //Статус платежа. Возможные значения: pending, waiting_for_capture, succeeded и canceled
+	Amount               Amount                 `json:"amount"`                          //Сумма платежа. Иногда партнеры Яндекс.Кассы берут с пользователя дополнительную комиссию, которая не входит в эту сумму
+	Description          string                 `json:"description"`                     //Описание транзакции, которое вы увидите в личном кабинете Яндекс.Кассы, а пользователь — при оплате. Например: «Оплата заказа № 72 для user@yandex.ru»
+	Recipient            Recipient              `json:"recipient"`                       //Получатель платежа. Нужен, если вы разделяете потоки платежей в рамках одного аккаунта или создаете платеж в адрес другого аккаунта
+	PaymentMethod        PaymentMethod          `json:"payment_method,omitempty"`        //Способ оплаты, который был использован для этого платежа. Конкретный тип (*BankCardMethod, *SberbankMethod и т.д.) определяется полем type
+	CapturedAt           string                 `json:"captured_at"`                     //Время подтверждения платежа. Указывается по UTC и передается в формате ISO 8601
+	CreatedAt            string                 `json:"created_at"`                      //Время создания заказа. Указывается по UTC и передается в формате ISO 8601. Пример: 2017-11-03T11:52:31.827Z
+	ExpiresAt            string                 `json:"expires_at"`                      //Время, до которого вы можете бесплатно отменить или подтвердить платеж. В указанное время платеж в статусе waiting_for_capture будет автоматически отменен. Указывается по UTC и передается в формате ISO 8601. Пример: 2017-11-03T11:52:31.827Z
+	Confirmation         ConfirmationResponse   `json:"confirmation"`                    //Выбранный способ подтверждения платежа. Присутствует, когда платеж ожидает подтверждения от пользователя
+	Test                 bool                   `json:"test"`                            //Признак тестовой операции
+	RefundedAmount       Amount                 `json:"refunded_amount"`                 //Сумма, которая вернулась пользователю. Присутствует, если у этого платежа есть успешные возвраты
+	Paid                 bool                   `json:"paid"`                            //Признак оплаты заказа
+	ReceiptRegistration  string                 `json:"receipt_registration"`            //Статус доставки данных для чека в онлайн-кассу (pending, succeeded или canceled). Присутствует, если вы используете решение Яндекс.Кассы для работы по 54-ФЗ
+	Metadata             map[string]interface{} `json:"metadata"`                        //Любые дополнительные данные, которые нужны вам для работы с платежами (например, номер заказа). Передаются в виде набора пар «ключ-значение» и возвращаются в ответе от Яндекс.Кассы. Ограничения: максимум 16 ключей, имя ключа не больше 32 символов, значение ключа не больше 512 символов
+	CancellationDetails  *CancellationDetails   `json:"cancellation_details,omitempty"`  //Комментарий к статусу canceled: кто отменил платеж и по какой причине
+	AuthorizationDetails *AuthorizationDetails  `json:"authorization_details,omitempty"` //Данные об авторизации платежа. Присутствует только для платежей банковской картой
+	Transfers            []Transfer             `json:"transfers,omitempty"`             //Распределение денег между магазинами-продавцами со статусами переводов
+	Deal                 *PaymentDeal           `json:"deal,omitempty"`                  //Безопасная сделка, к которой относится платеж
 }
 
-type Recipient struct {
-	GatewayID string `json:"gateway_id"` //Идентификатор шлюза. Используется для разделения потоков платежей в рамках одного аккаунта
+func (p PaymentRequest) MarshalJSON() ([]byte, error) {
+	type raw PaymentRequest
+	methodData, err := marshalTyped(p.PaymentMethodData)
+	if err != nil {
+		return nil, err
+	}
+	//Confirmation без типа не передается: сценарий подтверждения выбирается Яндекс.Кассой или не нужен (например, для сохраненного способа оплаты)
+	var confirmation *Confirmation
+	if p.Confirmation.Type != "" {
+		confirmation = &p.Confirmation
+	}
+	return json.Marshal(struct {
+		raw
+		PaymentMethodData json.RawMessage `json:"payment_method_data,omitempty"`
+		Confirmation      *Confirmation   `json:"confirmation,omitempty"`
+	}{raw(p), methodData, confirmation})
+}
+
+func (p *PaymentRequest) UnmarshalJSON(data []byte) error {
+	type raw PaymentRequest
+	var aux struct {
+		raw
+		PaymentMethodData json.RawMessage `json:"payment_method_data"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*p = PaymentRequest(aux.raw)
+	if isEmptyJSON(aux.PaymentMethodData) {
+		return nil
+	}
+	methodData, err := DecodePaymentMethodData(aux.PaymentMethodData)
+	if err != nil {
+		return err
+	}
+	p.PaymentMethodData = methodData
+	return nil
+}
+
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type raw Payment
+	method, err := marshalTyped(p.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	//Яндекс.Касса не передает confirmation, если платеж не ожидает подтверждения
+	var confirmation *ConfirmationResponse
+	if p.Confirmation.Type != "" {
+		confirmation = &p.Confirmation
+	}
+	return json.Marshal(struct {
+		raw
+		PaymentMethod json.RawMessage       `json:"payment_method,omitempty"`
+		Confirmation  *ConfirmationResponse `json:"confirmation,omitempty"`
+	}{raw(p), method, confirmation})
+}
+
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	type raw Payment
+	var aux struct {
+		raw
+		PaymentMethod json.RawMessage `json:"payment_method"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*p = Payment(aux.raw)
+	if isEmptyJSON(aux.PaymentMethod) {
+		return nil
+	}
+	method, err := DecodePaymentMethod(aux.PaymentMethod)
+	if err != nil {
+		return err
+	}
+	p.PaymentMethod = method
+	return nil
+}
+
+//Время создания платежа
+func (p *Payment) CreatedTime() (time.Time, error) {
+	return ParseTime(p.CreatedAt)
+}
+
+//Время подтверждения платежа. Нулевое, если платеж еще не подтвержден
+func (p *Payment) CapturedTime() (time.Time, error) {
+	return ParseTime(p.CapturedAt)
+}
+
+//Время, до которого можно бесплатно отменить или подтвердить платеж. Нулевое, если не указано
+func (p *Payment) ExpiresTime() (time.Time, error) {
+	return ParseTime(p.ExpiresAt)
+}
+
+//Фильтр для получения списка платежей. Пустые поля не передаются
+type PaymentListFilter struct {
+	CreatedAt     TimeFilter //Фильтр по времени создания платежа
+	CapturedAt    TimeFilter //Фильтр по времени подтверждения платежа (captured_at)
+	PaymentMethod string     //Способ оплаты (например: bank_card, sberbank)
+	Status        string     //Статус платежа (pending, waiting_for_capture, succeeded, canceled)
+	Limit         int        //Размер выдачи результатов запроса, от 1 до 100
+	Cursor        string     //Указатель на следующий фрагмент списка (next_cursor из предыдущего ответа)
+}
+
+func (f *PaymentListFilter) values() url.Values {
+	values := url.Values{}
+	if f == nil {
+		return values
+	}
+	f.CreatedAt.encode(values)
+	f.CapturedAt.encodeAs(values, "captured_at")
+	setString(values, "payment_method", f.PaymentMethod)
+	setString(values, "status", f.Status)
+	setInt(values, "limit", f.Limit)
+	setString(values, "cursor", f.Cursor)
+	return values
+}
+
+type PaymentList struct {
+	Type       string    `json:"type"`        //Формат выдачи результатов запроса (list)
+	Items      []Payment `json:"items"`       //Список платежей
+	NextCursor string    `json:"next_cursor"` //Указатель на следующий фрагмент списка. Отсутствует, если это последний фрагмент
+}
+
+//Участник процесса платежа, который принял решение об отмене
+type CancellationParty string
+
+const (
+	CancellationPartyYandexCheckout CancellationParty = "yandex_checkout" //Яндекс.Касса
+	CancellationPartyPaymentNetwork CancellationParty = "payment_network" //«Внешние» участники платежного процесса — все остальные участники, кроме Яндекс.Кассы и вас (например, эмитент, сторонний платежный сервис)
+	CancellationPartyMerchant       CancellationParty = "merchant"        //Продавец товаров и услуг (вы)
+)
+
+//Причина отмены платежа
+type CancellationReason string
+
+const (
+	CancellationReason3DSecureFailed             CancellationReason = "3d_secure_failed"
+	CancellationReasonCallIssuer                 CancellationReason = "call_issuer"
+	CancellationReasonCanceledByMerchant         CancellationReason = "canceled_by_merchant"
+	CancellationReasonCardExpired                CancellationReason = "card_expired"
+	CancellationReasonCountryForbidden           CancellationReason = "country_forbidden"
+	CancellationReasonExpiredOnCapture           CancellationReason = "expired_on_capture"
+	CancellationReasonExpiredOnConfirmation      CancellationReason = "expired_on_confirmation"
+	CancellationReasonFraudSuspected             CancellationReason = "fraud_suspected"
+	CancellationReasonGeneralDecline             CancellationReason = "general_decline"
+	CancellationReasonIdentificationRequired     CancellationReason = "identification_required"
+	CancellationReasonInsufficientFunds          CancellationReason = "insufficient_funds"
+	CancellationReasonInternalTimeout            CancellationReason = "internal_timeout"
+	CancellationReasonInvalidCardNumber          CancellationReason = "invalid_card_number"
+	CancellationReasonInvalidCsc                 CancellationReason = "invalid_csc"
+	CancellationReasonIssuerUnavailable          CancellationReason = "issuer_unavailable"
+	CancellationReasonPaymentMethodLimitExceeded CancellationReason = "payment_method_limit_exceeded"
+	CancellationReasonPaymentMethodRestricted    CancellationReason = "payment_method_restricted"
+	CancellationReasonPermissionRevoked          CancellationReason = "permission_revoked"
+)
+
+var cancellationReasonDescriptions = map[CancellationReason]string{
+	CancellationReason3DSecureFailed:             "Не пройдена аутентификация по 3-D Secure. Пользователю следует повторить попытку, обратиться в банк за уточнениями или использовать другое платежное средство",
+	CancellationReasonCallIssuer:                 "Оплата данным платежным средством отклонена по неизвестным причинам. Пользователю следует обратиться в организацию, выпустившую платежное средство",
+	CancellationReasonCanceledByMerchant:         "Платеж отменен по API при оплате в две стадии",
+	CancellationReasonCardExpired:                "Истек срок действия банковской карты. Пользователю следует использовать другое платежное средство",
+	CancellationReasonCountryForbidden:           "Нельзя заплатить банковской картой, выпущенной в этой стране",
+	CancellationReasonExpiredOnCapture:           "Истек срок списания оплаты у двухстадийного платежа. Если вы еще хотите принять оплату, повторите платеж с новым ключом идемпотентности и спишите деньги после подтверждения пользователем",
+	CancellationReasonExpiredOnConfirmation:      "Истек срок оплаты: пользователь не подтвердил платеж за время, отведенное на оплату выбранным способом",
+	CancellationReasonFraudSuspected:             "Платеж заблокирован из-за подозрения в мошенничестве. Пользователю следует использовать другое платежное средство",
+	CancellationReasonGeneralDecline:             "Причина не детализирована. Пользователю следует обратиться к инициатору отмены платежа за уточнением подробностей",
+	CancellationReasonIdentificationRequired:     "Превышены ограничения на платежи для кошелька в Яндекс.Деньгах. Пользователю следует идентифицировать кошелек или выбрать другое платежное средство",
+	CancellationReasonInsufficientFunds:          "Не хватает денег для оплаты. Пользователю следует пополнить баланс или использовать другое платежное средство",
+	CancellationReasonInternalTimeout:            "Технические неполадки на стороне Яндекс.Кассы: не удалось обработать запрос в течение 30 секунд. Повторите платеж с новым ключом идемпотентности",
+	CancellationReasonInvalidCardNumber:          "Неправильно указан номер карты. Пользователю следует повторить попытку и ввести корректные данные",
+	CancellationReasonInvalidCsc:                 "Неправильно указан код CVV2 (CVC2, CID). Пользователю следует повторить попытку и ввести корректные данные",
+	CancellationReasonIssuerUnavailable:          "Организация, выпустившая платежное средство, недоступна. Пользователю следует повторить попытку позже или использовать другое платежное средство",
+	CancellationReasonPaymentMethodLimitExceeded: "Исчерпан лимит платежей для данного платежного средства или вашего магазина. Пользователю следует повторить попытку на следующий день или использовать другое платежное средство",
+	CancellationReasonPaymentMethodRestricted:    "Запрещены операции данным платежным средством (например, карта заблокирована из-за утери). Пользователю следует обратиться в организацию, выпустившую платежное средство",
+	CancellationReasonPermissionRevoked:          "Нельзя провести безакцептное списание: пользователь отозвал разрешение на автоплатежи. Если пользователь еще хочет оплатить, необходимо создать новый платеж, а пользователь должен подтвердить оплату",
+}
+
+//Описание причины отмены для показа сотрудникам поддержки. Для неизвестной причины возвращается ее код
+func (r CancellationReason) Description() string {
+	if description, ok := cancellationReasonDescriptions[r]; ok {
+		return description
+	}
+	return string(r)
+}
+
+type CancellationDetails struct {
+	Party  CancellationParty  `json:"party"`  //Участник процесса платежа, который принял решение об отмене
+	Reason CancellationReason `json:"reason"` //Причина отмены платежа
+}
+
+type AuthorizationDetails struct {
+	RRN          string       `json:"rrn"`            //Retrieval Reference Number — уникальный идентификатор транзакции в системе эмитента
+	AuthCode     string       `json:"auth_code"`      //Код авторизации банковской карты, выдается эмитентом и подтверждает проведение авторизации
+	ThreeDSecure ThreeDSecure `json:"three_d_secure"` //Данные о прохождении пользователем аутентификации по 3-D Secure
 }
 
-type PaymentMethodData struct {
-	Type string `json:"type"` //Тип объекта (например: bank_card, sberbank)
-	Card Card   `json:"card"` //Данные банковской карты (необходимы, если вы собираете данные карты пользователей на своей стороне)
+type ThreeDSecure struct {
+	Applied bool `json:"applied"` //Отображение пользователю формы для прохождения аутентификации по 3-D Secure
 }
 
-type Card struct {
-	Number      string `json:"number"`       //Номер банковской карты
-	ExpiryYear  string `json:"expiry_year"`  //Срок действия, год, YYYY
-	ExpiryMonth string `json:"expiry_month"` //Срок действия, месяц, MM
-	CSC         string `json:"csc"`          //Код CVC2 или CVV2, 3 или 4 символа, печатается на обратной стороне карты
-	Cardholder  string `json:"cardholder"`   //Имя владельца карты
+type Recipient struct {
+	AccountID string `json:"account_id,omitempty"` //Идентификатор магазина, которому поступит платеж. Заполняется Яндекс.Кассой в ответах и уведомлениях
+	GatewayID string `json:"gateway_id"`           //Идентификатор шлюза. Используется для разделения потоков платежей в рамках одного аккаунта
 }
 
+//Сценарии подтверждения платежа пользователем (поле type в Confirmation и ConfirmationResponse)
+const (
+	ConfirmationRedirect          = "redirect"           //Пользователь перенаправляется на веб-страницу Яндекс.Кассы или партнера
+	ConfirmationEmbedded          = "embedded"           //Подтверждение через виджет Яндекс.Кассы по confirmation_token
+	ConfirmationQR                = "qr"                 //Пользователь сканирует QR-код, содержимое которого передается в confirmation_data
+	ConfirmationExternal          = "external"           //Пользователь подтверждает платеж самостоятельно (например, ответом на смс или в приложении банка)
+	ConfirmationMobileApplication = "mobile_application" //Пользователь подтверждает платеж в мобильном приложении по диплинку
+)
+
+//Язык интерфейса, писем и смс, которые будет видеть или получать пользователь
+const (
+	LocaleRU = "ru_RU"
+	LocaleEN = "en_US"
+)
+
 type Confirmation struct {
-	Type      string `json:"type"`       //Тип объекта redirect. Сценарий, при котором необходимо отправить пользователя на веб-страницу Яндекс.Кассы для подтверждения платежа (например: redirect)
-	Enforce   bool   `json:"enforce"`    //Требование принудительного подтверждения платежа пользователем. Например, требование 3-D Secure при оплате банковской картой (по умолчанию определяется политикой платежной системы)
-	ReturnUrl string `json:"return_url"` //URL, на который вернется пользователь после подтверждения или отмены платежа на веб-странице
+	Type      string `json:"type"`                 //Сценарий подтверждения платежа пользователем, одна из констант Confirmation* (например: redirect)
+	Locale    string `json:"locale,omitempty"`     //Язык интерфейса, писем и смс (LocaleRU или LocaleEN)
+	Enforce   bool   `json:"enforce,omitempty"`    //Требование принудительного подтверждения платежа пользователем. Например, требование 3-D Secure при оплате банковской картой (по умолчанию определяется политикой платежной системы). Только для redirect
+	ReturnUrl string `json:"return_url,omitempty"` //URL, на который вернется пользователь после подтверждения или отмены платежа на веб-странице или в приложении. Для redirect и mobile_application
 }
 
 type ConfirmationResponse struct {
-	Type            string `json:"type"`             //Тип объекта redirect. Сценарий, при котором необходимо отправить пользователя на веб-страницу Яндекс.Кассы для подтверждения платежа (например: redirect)
-	Enforce         bool   `json:"enforce"`          //Требование принудительного подтверждения платежа пользователем. Например, требование 3-D Secure при оплате банковской картой (по умолчанию определяется политикой платежной системы)
-	ReturnUrl       string `json:"return_url"`       //URL, на который вернется пользователь после подтверждения или отмены платежа на веб-странице
-	ConfirmationUrl string `json:"confirmation_url"` //URL, на который необходимо перенаправить пользователя для подтверждения оплаты
+	Type              string `json:"type"`                         //Сценарий подтверждения платежа пользователем, одна из констант Confirmation* (например: redirect)
+	Locale            string `json:"locale,omitempty"`             //Язык интерфейса, писем и смс
+	Enforce           bool   `json:"enforce,omitempty"`            //Требование принудительного подтверждения платежа пользователем. Например, требование 3-D Secure при оплате банковской картой (по умолчанию определяется политикой платежной системы)
+	ReturnUrl         string `json:"return_url,omitempty"`         //URL, на который вернется пользователь после подтверждения или отмены платежа на веб-странице
+	ConfirmationUrl   string `json:"confirmation_url,omitempty"`   //URL, на который необходимо перенаправить пользователя для подтверждения оплаты (redirect), или диплинк на мобильное приложение (mobile_application)
+	ConfirmationToken string `json:"confirmation_token,omitempty"` //Токен для инициализации виджета Яндекс.Кассы (embedded)
+	ConfirmationData  string `json:"confirmation_data,omitempty"`  //Данные для генерации QR-кода (qr)
+}
+
+//Данные, которые нужно показать пользователю для подтверждения платежа: URL или диплинк для redirect и mobile_application,
+//токен виджета для embedded, содержимое QR-кода для qr. Для external возвращается пустая строка
+func (c *ConfirmationResponse) Payload() string {
+	switch c.Type {
+	case ConfirmationRedirect, ConfirmationMobileApplication:
+		return c.ConfirmationUrl
+	case ConfirmationEmbedded:
+		return c.ConfirmationToken
+	case ConfirmationQR:
+		return c.ConfirmationData
+	default:
+		return ""
+	}
 }
 
 type Airline struct {
@@ -120,146 +386,74 @@ type Leg struct {
 	DepartureDate      string `json:"departure_date"`      //Дата вылета в формате YYYY-MM-DD ISO 8601:2004
 }
 
-type PaymentMethod struct {
-	Type  string `json:"type"`  //тип объекта
-	ID    string `json:"id"`    //Идентификатор способа оплаты
-	Saved bool   `json:"saved"` //С помощью сохраненного способа оплаты можно проводить безакцептные списания
-	Title string `json:"title"` //Название способа оплаты
-	Phone string `json:"phone"` //Телефон пользователя, на который зарегистрирован аккаунт в Сбербанке Онлайн. Необходим для подтверждения оплаты по смс (сценарий подтверждения external). Указывается в формате ITU-T E.164, например 79000000000
-}
-
 type Processing struct {
-	Type        string `json:"type"`         //тип ошибки (e.g. Processing)
-	Description string `json:"description"`  //описание самой ошибки
-	RetryAfter  int64  `json: "retry_after"` //Через сколько нужно повторить запрос
+	Type        string `json:"type"`        //тип ошибки (e.g. Processing)
+	Description string `json:"description"` //описание самой ошибки
+	RetryAfter  int64  `json:"retry_after"` //Через сколько нужно повторить запрос
 }
 
-//
 func (k *Kassa) CreatePayment(inputPayment *PaymentRequest) (*Payment, *Processing, error) {
-	const url = "https://payment.yandex.net/api/v3/payments"
-
-	serializedPayment, err := json.Marshal(inputPayment)
-	if err != nil {
+	if err := ValidateTransfers(inputPayment.Amount, inputPayment.Transfers); err != nil {
 		return nil, nil, err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(serializedPayment))
-	if err != nil {
-		return nil, nil, err
-	}
-	req.SetBasicAuth(k.IdempotenceKey, k.SecretKey)
-	req.Header.Set("Idempotence-Key", k.IdempotenceKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var payment Payment
-		err = json.Unmarshal(body, &payment)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return &payment, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, &yandexError
+	var payment Payment
+	processing, err := k.do(http.MethodPost, "/payments", inputPayment, &payment)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
+	k.keepPayment(&payment)
+	return &payment, nil, nil
 }
 
 func (k *Kassa) PaymentInfo(paymentId string) (*Payment, *Processing, error) {
-	url := fmt.Sprintf("https://payment.yandex.net/api/v3/payments/%s", paymentId)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req.SetBasicAuth(k.IdempotenceKey, k.SecretKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer resp.Body.Close()
+	return k.PaymentInfoContext(context.Background(), paymentId)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
+//PaymentInfoContext — PaymentInfo с контекстом: запрос прерывается, когда ctx завершается
+func (k *Kassa) PaymentInfoContext(ctx context.Context, paymentId string) (*Payment, *Processing, error) {
+	var payment Payment
+	processing, err := k.doContext(ctx, http.MethodGet, "/payments/"+url.PathEscape(paymentId), nil, &payment)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
+	k.keepPayment(&payment)
+	return &payment, nil, nil
+}
 
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var payment Payment
-		err = json.Unmarshal(body, &payment)
+//PaymentNotification возвращает обработчик уведомлений о платежах. Платеж из уведомления сохраняется в Store,
+//после чего для waiting_for_capture вызывается captureFunction, а для succeeded — succeedFunction.
+//Возвраты из уведомлений refund.* только сохраняются в Store. Если сохранить не удалось, обработчик отвечает 500,
+//и Яндекс.Касса повторит уведомление
+func (k *Kassa) PaymentNotification(captureFunction, succeedFunction func(*Kassa, *Payment) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, q *http.Request) {
+		body, err := ioutil.ReadAll(q.Body)
 		if err != nil {
-			return nil, nil, err
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-
-		return &payment, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
+		payment, refund, err := decodeNotification(body)
 		if err != nil {
-			return nil, nil, err
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
+		if refund != nil {
+			if err = k.saveRefund(refund); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
 		}
-		return nil, nil, &yandexError
-	}
-}
-
-func (k *Kassa) PaymentNotification(captureFunction, succeedFunction func(*Kassa, *Payment) error) http.HandlerFunc {
-	return func(w http.ResponseWriter, q *http.Request) {
-		decoder := json.NewDecoder(q.Body)
-		var payment Payment
-		err := decoder.Decode(&payment)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			panic(err)
-		} else {
+		if payment != nil {
+			if err = k.savePayment(payment); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			if payment.Status == "waiting_for_capture" {
-				if err = captureFunction(k, &payment); err != nil {
+				if err = captureFunction(k, payment); err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					panic(err)
 				}
 			} else if payment.Status == "succeeded" {
-				if err = succeedFunction(k, &payment); err != nil {
+				if err = succeedFunction(k, payment); err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					panic(err)
 				}
@@ -269,117 +463,53 @@ func (k *Kassa) PaymentNotification(captureFunction, succeedFunction func(*Kassa
 	}
 }
 
+//PaymentConfirm подтверждает платеж, беря из inputPayment только Amount, Receipt и Airline. Пустые поля не передаются,
+//так что платеж с пустым Amount подтверждается на всю сумму. Для частичного подтверждения удобнее CapturePayment
 func (k *Kassa) PaymentConfirm(paymentId string, inputPayment *PaymentRequest) (*Payment, *Processing, error) {
-	url := fmt.Sprintf("https://payment.yandex.net/api/v3/payments/%s/capture", paymentId)
-
 	paymentConfirmData := &PaymentConfirmRequest{
 		Amount:  inputPayment.Amount,
 		Receipt: inputPayment.Receipt,
 		Airline: inputPayment.Airline}
+	return k.capture(paymentId, paymentConfirmData.CaptureRequest())
+}
 
-	serializedPayment, err := json.Marshal(paymentConfirmData)
-	if err != nil {
-		return nil, nil, err
-	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(serializedPayment))
-	if err != nil {
-		return nil, nil, err
-	}
-	req.Header.Set(k.IdempotenceKey, k.SecretKey)
-	req.Header.Set("Idempotence-Key", k.IdempotenceKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var payment Payment
-		err = json.Unmarshal(body, &payment)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return &payment, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, &yandexError
+func (k *Kassa) capture(paymentId string, paymentConfirmData *CaptureRequest) (*Payment, *Processing, error) {
+	var payment Payment
+	processing, err := k.do(http.MethodPost, "/payments/"+url.PathEscape(paymentId)+"/capture", paymentConfirmData, &payment)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
+	k.keepPayment(&payment)
+	return &payment, nil, nil
 }
 
 func (k *Kassa) PaymentCancel(paymentId string) (*Payment, *Processing, error) {
-	url := fmt.Sprintf("https://payment.yandex.net/api/v3/payments/%s/cancel", paymentId)
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return nil, nil, err
+	var payment Payment
+	processing, err := k.do(http.MethodPost, "/payments/"+url.PathEscape(paymentId)+"/cancel", nil, &payment)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
-	req.Header.Set(k.IdempotenceKey, k.SecretKey)
-	req.Header.Set("Idempotence-Key", k.IdempotenceKey)
-	req.Header.Set("Content-Type", "application/json")
+	k.keepPayment(&payment)
+	return &payment, nil, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer resp.Body.Close()
+func (k *Kassa) ListPayments(filter *PaymentListFilter) (*PaymentList, *Processing, error) {
+	return k.ListPaymentsContext(context.Background(), filter)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
+//ListPaymentsContext — ListPayments с контекстом: запрос прерывается, когда ctx завершается
+func (k *Kassa) ListPaymentsContext(ctx context.Context, filter *PaymentListFilter) (*PaymentList, *Processing, error) {
+	path := "/payments"
+	if query := filter.values().Encode(); query != "" {
+		path += "?" + query
 	}
-
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var payment Payment
-		err = json.Unmarshal(body, &payment)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return &payment, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, &yandexError
+	var list PaymentList
+	processing, err := k.doContext(ctx, http.MethodGet, path, nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	for i := range list.Items {
+		k.keepPayment(&list.Items[i])
 	}
+	return &list, nil, nil
 }
@@ -0,0 +1,318 @@
+package yandexkassa
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+/*
+	Способ оплаты приходит от Яндекс.Кассы в поле payment_method и отличается набором полей в зависимости от типа.
+	PaymentMethod и PaymentMethodData — интерфейсы, конкретная структура выбирается по значению поля type.
+	Поле type добавляется при сериализации Payment и PaymentRequest по значению Type().
+
+	Раньше PaymentMethod был структурой с полями Type, ID, Saved, Title и Phone. Поля ID, Saved и Title теперь
+	в Common(), тип — в Type(), а телефон есть только у *SberbankMethod.
+	Неизвестные библиотеке типы разбираются в UnknownPaymentMethod и UnknownPaymentMethodData.
+*/
+
+//Способ оплаты, который был использован для платежа (поле payment_method в Payment)
+type PaymentMethod interface {
+	Type() string                //Тип способа оплаты, одна из констант PaymentMethod*
+	Common() PaymentMethodCommon //Поля, общие для всех способов оплаты
+}
+
+//Данные для создания способа оплаты (поле payment_method_data в PaymentRequest)
+type PaymentMethodData interface {
+	Type() string //Тип способа оплаты, одна из констант PaymentMethod*
+}
+
+type PaymentMethodCommon struct {
+	ID    string `json:"id"`    //Идентификатор способа оплаты
+	Saved bool   `json:"saved"` //С помощью сохраненного способа оплаты можно проводить безакцептные списания
+	Title string `json:"title"` //Название способа оплаты
+}
+
+func (c PaymentMethodCommon) Common() PaymentMethodCommon {
+	return c
+}
+
+type BankCardMethod struct {
+	PaymentMethodCommon
+	Card CardInfo `json:"card"` //Данные банковской карты
+}
+
+type CardInfo struct {
+	First6        string `json:"first6"`         //Первые 6 цифр номера карты (BIN)
+	Last4         string `json:"last4"`          //Последние 4 цифры номера карты
+	ExpiryYear    string `json:"expiry_year"`    //Срок действия, год, YYYY
+	ExpiryMonth   string `json:"expiry_month"`   //Срок действия, месяц, MM
+	CardType      string `json:"card_type"`      //Тип банковской карты (например: MasterCard, Visa, Mir)
+	IssuerCountry string `json:"issuer_country"` //Код страны, в которой выпущена карта, ISO-3166 alpha-2
+	IssuerName    string `json:"issuer_name"`    //Наименование банка, выпустившего карту
+}
+
+type SberbankMethod struct {
+	PaymentMethodCommon
+	Phone string `json:"phone"` //Телефон пользователя, на который зарегистрирован аккаунт в Сбербанке Онлайн. Указывается в формате ITU-T E.164, например 79000000000
+}
+
+type YandexMoneyMethod struct {
+	PaymentMethodCommon
+	AccountNumber string `json:"account_number"` //Номер кошелька в Яндекс.Деньгах, из которого заплатил пользователь
+}
+
+type QiwiMethod struct {
+	PaymentMethodCommon
+}
+
+type AlfabankMethod struct {
+	PaymentMethodCommon
+	Login string `json:"login"` //Логин пользователя в Альфа-Клике
+}
+
+type WebmoneyMethod struct {
+	PaymentMethodCommon
+}
+
+type ApplePayMethod struct {
+	PaymentMethodCommon
+}
+
+type MobileBalanceMethod struct {
+	PaymentMethodCommon
+}
+
+type CashMethod struct {
+	PaymentMethodCommon
+}
+
+type InstallmentsMethod struct {
+	PaymentMethodCommon
+}
+
+type SbpMethod struct {
+	PaymentMethodCommon
+	SbpOperationID   string            `json:"sbp_operation_id,omitempty"`   //Идентификатор операции в СБП. Присутствует после оплаты
+	PayerBankDetails *PayerBankDetails `json:"payer_bank_details,omitempty"` //Банк, из приложения которого заплатил пользователь
+}
+
+type PayerBankDetails struct {
+	BankID string `json:"bank_id"` //Идентификатор банка в СБП
+	BIC    string `json:"bic"`     //БИК банка
+}
+
+//Способ оплаты, тип которого не известен этой библиотеке
+type UnknownPaymentMethod struct {
+	PaymentMethodCommon
+	MethodType string `json:"-"` //Значение поля type
+}
+
+func (BankCardMethod) Type() string         { return PaymentMethodBankCard }
+func (SberbankMethod) Type() string         { return PaymentMethodSberbank }
+func (YandexMoneyMethod) Type() string      { return PaymentMethodYandexMoney }
+func (QiwiMethod) Type() string             { return PaymentMethodQiwi }
+func (AlfabankMethod) Type() string         { return PaymentMethodAlfabank }
+func (WebmoneyMethod) Type() string         { return PaymentMethodWebmoney }
+func (ApplePayMethod) Type() string         { return PaymentMethodApplePay }
+func (MobileBalanceMethod) Type() string    { return PaymentMethodMobileBalance }
+func (CashMethod) Type() string             { return PaymentMethodCash }
+func (InstallmentsMethod) Type() string     { return PaymentMethodInstallments }
+func (SbpMethod) Type() string              { return PaymentMethodSbp }
+func (m UnknownPaymentMethod) Type() string { return m.MethodType }
+
+//DecodePaymentMethod разбирает объект payment_method, выбирая структуру по полю type
+func DecodePaymentMethod(data []byte) (PaymentMethod, error) {
+	typ, err := decodeType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var method PaymentMethod
+	switch typ {
+	case PaymentMethodBankCard:
+		method = &BankCardMethod{}
+	case PaymentMethodSberbank:
+		method = &SberbankMethod{}
+	case PaymentMethodYandexMoney:
+		method = &YandexMoneyMethod{}
+	case PaymentMethodQiwi:
+		method = &QiwiMethod{}
+	case PaymentMethodAlfabank:
+		method = &AlfabankMethod{}
+	case PaymentMethodWebmoney:
+		method = &WebmoneyMethod{}
+	case PaymentMethodApplePay:
+		method = &ApplePayMethod{}
+	case PaymentMethodMobileBalance:
+		method = &MobileBalanceMethod{}
+	case PaymentMethodCash:
+		method = &CashMethod{}
+	case PaymentMethodInstallments:
+		method = &InstallmentsMethod{}
+	case PaymentMethodSbp:
+		method = &SbpMethod{}
+	default:
+		method = &UnknownPaymentMethod{MethodType: typ}
+	}
+
+	if err = json.Unmarshal(data, method); err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+type BankCardData struct {
+	Card Card `json:"card"` //Данные банковской карты (необходимы, если вы собираете данные карты пользователей на своей стороне)
+}
+
+type Card struct {
+	Number      string `json:"number"`       //Номер банковской карты
+	ExpiryYear  string `json:"expiry_year"`  //Срок действия, год, YYYY
+	ExpiryMonth string `json:"expiry_month"` //Срок действия, месяц, MM
+	CSC         string `json:"csc"`          //Код CVC2 или CVV2, 3 или 4 символа, печатается на обратной стороне карты
+	Cardholder  string `json:"cardholder"`   //Имя владельца карты
+}
+
+type SberbankData struct {
+	Phone string `json:"phone,omitempty"` //Телефон пользователя для подтверждения оплаты по смс (сценарий подтверждения external). Указывается в формате ITU-T E.164, например 79000000000
+}
+
+type YandexMoneyData struct {
+}
+
+type QiwiData struct {
+	Phone string `json:"phone,omitempty"` //Телефон, на который зарегистрирован аккаунт в QIWI. Указывается в формате ITU-T E.164
+}
+
+type AlfabankData struct {
+	Login string `json:"login,omitempty"` //Логин пользователя в Альфа-Клике (сценарий подтверждения external)
+}
+
+type WebmoneyData struct {
+}
+
+type ApplePayData struct {
+	PaymentData string `json:"payment_data"` //Содержимое поля paymentData объекта PKPaymentToken, закодированное в Base64
+}
+
+type MobileBalanceData struct {
+	Phone string `json:"phone"` //Телефон, с баланса которого осуществляется платеж. Указывается в формате ITU-T E.164
+}
+
+type CashData struct {
+	Phone string `json:"phone,omitempty"` //Телефон пользователя, на который придет смс с кодом платежа (для внесения наличных)
+}
+
+type InstallmentsData struct {
+}
+
+//Оплата через СБП. Платеж подтверждается по QR-коду (Confirmation с типом qr) или диплинку в приложение банка (redirect)
+type SbpData struct {
+}
+
+//Данные способа оплаты, тип которого не известен этой библиотеке
+type UnknownPaymentMethodData struct {
+	MethodType string `json:"-"` //Значение поля type
+}
+
+func (BankCardData) Type() string               { return PaymentMethodBankCard }
+func (SberbankData) Type() string               { return PaymentMethodSberbank }
+func (YandexMoneyData) Type() string            { return PaymentMethodYandexMoney }
+func (QiwiData) Type() string                   { return PaymentMethodQiwi }
+func (AlfabankData) Type() string               { return PaymentMethodAlfabank }
+func (WebmoneyData) Type() string               { return PaymentMethodWebmoney }
+func (ApplePayData) Type() string               { return PaymentMethodApplePay }
+func (MobileBalanceData) Type() string          { return PaymentMethodMobileBalance }
+func (CashData) Type() string                   { return PaymentMethodCash }
+func (InstallmentsData) Type() string           { return PaymentMethodInstallments }
+func (SbpData) Type() string                    { return PaymentMethodSbp }
+func (d UnknownPaymentMethodData) Type() string { return d.MethodType }
+
+//DecodePaymentMethodData разбирает объект payment_method_data, выбирая структуру по полю type
+func DecodePaymentMethodData(data []byte) (PaymentMethodData, error) {
+	typ, err := decodeType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var methodData PaymentMethodData
+	switch typ {
+	case PaymentMethodBankCard:
+		methodData = &BankCardData{}
+	case PaymentMethodSberbank:
+		methodData = &SberbankData{}
+	case PaymentMethodYandexMoney:
+		methodData = &YandexMoneyData{}
+	case PaymentMethodQiwi:
+		methodData = &QiwiData{}
+	case PaymentMethodAlfabank:
+		methodData = &AlfabankData{}
+	case PaymentMethodWebmoney:
+		methodData = &WebmoneyData{}
+	case PaymentMethodApplePay:
+		methodData = &ApplePayData{}
+	case PaymentMethodMobileBalance:
+		methodData = &MobileBalanceData{}
+	case PaymentMethodCash:
+		methodData = &CashData{}
+	case PaymentMethodInstallments:
+		methodData = &InstallmentsData{}
+	case PaymentMethodSbp:
+		methodData = &SbpData{}
+	default:
+		methodData = &UnknownPaymentMethodData{MethodType: typ}
+	}
+
+	if err = json.Unmarshal(data, methodData); err != nil {
+		return nil, err
+	}
+	return methodData, nil
+}
+
+func isEmptyJSON(data json.RawMessage) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+func decodeType(data []byte) (string, error) {
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return "", err
+	}
+	return object.Type, nil
+}
+
+//typed — способ оплаты или данные для его создания, тип которых известен по Type()
+type typed interface {
+	Type() string
+}
+
+//marshalTyped сериализует способ оплаты с полем type. Для nil, в том числе nil-указателя
+//конкретного типа, возвращается nil, и поле с omitempty не передается
+func marshalTyped(v typed) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil, nil
+	}
+	return marshalWithType(v.Type(), v)
+}
+
+//marshalWithType сериализует v и добавляет к объекту поле type
+func marshalWithType(typ string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields["type"], err = json.Marshal(typ); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,57 @@
+package yandexkassa_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+)
+
+func TestTypedNilPaymentMethodData(t *testing.T) {
+	request := yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: (*yandexkassa.BankCardData)(nil)}
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "payment_method_data") {
+		t.Fatalf("nil payment_method_data is sent: %s", data)
+	}
+
+	payment := yandexkassa.Payment{ID: "p1", PaymentMethod: (*yandexkassa.BankCardMethod)(nil)}
+	if data, err = json.Marshal(payment); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "payment_method") {
+		t.Fatalf("nil payment_method is sent: %s", data)
+	}
+}
+
+func TestUnknownPaymentMethodTypes(t *testing.T) {
+	var payment yandexkassa.Payment
+	err := json.Unmarshal([]byte(`{"id":"p1","payment_method":{"type":"tinkoff_bank","id":"m1","saved":false}}`), &payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.PaymentMethod.Type() != "tinkoff_bank" || payment.PaymentMethod.Common().ID != "m1" {
+		t.Fatalf("got %+v", payment.PaymentMethod)
+	}
+
+	var request yandexkassa.PaymentRequest
+	err = json.Unmarshal([]byte(`{"amount":{"value":"1.00","currency":"RUB"},"payment_method_data":{"type":"tinkoff_bank"}}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.PaymentMethodData.Type() != "tinkoff_bank" {
+		t.Fatalf("got %+v", request.PaymentMethodData)
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"payment_method_data":{"type":"tinkoff_bank"}`) {
+		t.Fatalf("type is lost: %s", data)
+	}
+}
@@ -0,0 +1,122 @@
+package yandexkassa_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+)
+
+func TestPaymentConfirmRequestCompatible(t *testing.T) {
+	//Литерал в старом виде, со значениями вместо указателей
+	request := yandexkassa.PaymentConfirmRequest{Amount: yandexkassa.Amount{Value: "5.00", Currency: "RUB"}}
+
+	capture := request.CaptureRequest()
+	if capture.Amount == nil || capture.Amount.Value != "5.00" {
+		t.Fatalf("amount converted to %v", capture.Amount)
+	}
+	if capture.Receipt != nil || capture.Airline != nil {
+		t.Fatalf("empty fields are sent: %+v", capture)
+	}
+
+	capture.Amount.Value = "1.00"
+	if request.Amount.Value != "5.00" {
+		t.Fatal("CaptureRequest shares the amount with the original request")
+	}
+}
+
+//Ответы Яндекс.Кассы из документации API для каждого сценария подтверждения
+var confirmationSamples = []struct {
+	response string
+	typ      string
+	payload  string
+}{
+	{`{"id":"22e12f66-000f-5000-8000-18db351245c7","status":"pending","paid":false,"amount":{"value":"2.00","currency":"RUB"},"confirmation":{"type":"redirect","return_url":"https://www.merchant-website.com/return_url","confirmation_url":"https://money.yandex.ru/api-pages/v2/payment-confirm/epl?orderId=22e12f66-000f-5000-8000-18db351245c7"},"created_at":"2018-07-18T10:51:18.139Z","description":"Заказ №72","metadata":{},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false}`,
+		yandexkassa.ConfirmationRedirect, "https://money.yandex.ru/api-pages/v2/payment-confirm/epl?orderId=22e12f66-000f-5000-8000-18db351245c7"},
+	{`{"id":"24301ae5-000f-5000-9000-13f5f1c2f8e0","status":"pending","paid":false,"amount":{"value":"2.00","currency":"RUB"},"confirmation":{"type":"embedded","confirmation_token":"ct-24301ae5-000f-5000-9000-13f5f1c2f8e0"},"created_at":"2019-03-12T11:10:41.802Z","description":"Заказ №72","metadata":{},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false}`,
+		yandexkassa.ConfirmationEmbedded, "ct-24301ae5-000f-5000-9000-13f5f1c2f8e0"},
+	{`{"id":"2783a7f5-000f-5000-9000-1c9ad2bd3c44","status":"pending","paid":false,"amount":{"value":"2.00","currency":"RUB"},"confirmation":{"type":"qr","confirmation_data":"https://qr.nspk.ru/AS1A0049P9D3V4CN8O2BS2GH6T1T8E1D?type=02&bank=100000000022&sum=200&cur=RUB&crc=ED6C"},"created_at":"2021-01-19T11:46:29.418Z","description":"Заказ №72","metadata":{},"payment_method":{"type":"sbp","id":"2783a7f5-000f-5000-9000-1c9ad2bd3c44","saved":false},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false}`,
+		yandexkassa.ConfirmationQR, "https://qr.nspk.ru/AS1A0049P9D3V4CN8O2BS2GH6T1T8E1D?type=02&bank=100000000022&sum=200&cur=RUB&crc=ED6C"},
+	{`{"id":"2419a771-000f-5000-9000-1edaf29243f2","status":"pending","paid":false,"amount":{"value":"2.00","currency":"RUB"},"confirmation":{"type":"mobile_application","confirmation_url":"sberpay://invoicing/v2?bankInvoiceId=4f3a2a4d61cd4a7d9a37ff4b5c2b9f9c&operationType=App2App"},"created_at":"2019-03-12T11:10:41.802Z","description":"Заказ №72","metadata":{},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false}`,
+		yandexkassa.ConfirmationMobileApplication, "sberpay://invoicing/v2?bankInvoiceId=4f3a2a4d61cd4a7d9a37ff4b5c2b9f9c&operationType=App2App"},
+	{`{"id":"2419a771-000f-5000-9000-1edaf29243f3","status":"pending","paid":false,"amount":{"value":"2.00","currency":"RUB"},"confirmation":{"type":"external"},"created_at":"2019-03-12T11:10:41.802Z","description":"Заказ №72","metadata":{},"payment_method":{"type":"sberbank","id":"2419a771-000f-5000-9000-1edaf29243f3","saved":false,"phone":"79000000000"},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false}`,
+		yandexkassa.ConfirmationExternal, ""},
+}
+
+func TestConfirmationRoundTrip(t *testing.T) {
+	for _, sample := range confirmationSamples {
+		var payment yandexkassa.Payment
+		if err := json.Unmarshal([]byte(sample.response), &payment); err != nil {
+			t.Fatal(err)
+		}
+		if payment.Confirmation.Type != sample.typ || payment.Confirmation.Payload() != sample.payload {
+			t.Errorf("%s: got %+v, payload %q", sample.typ, payment.Confirmation, payment.Confirmation.Payload())
+		}
+
+		data, err := json.Marshal(payment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again yandexkassa.Payment
+		if err = json.Unmarshal(data, &again); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(again, payment) {
+			t.Errorf("%s: round trip changed the payment:\n%+v\n%+v", sample.typ, payment, again)
+		}
+	}
+}
+
+func TestPaymentWithoutConfirmation(t *testing.T) {
+	data, err := json.Marshal(yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "confirmation") {
+		t.Fatalf("empty confirmation is sent: %s", data)
+	}
+}
+
+func TestCancellationAndAuthorizationDetails(t *testing.T) {
+	//Ответы Яндекс.Кассы из документации API: отмененный и оплаченный банковской картой платежи
+	canceled := `{"id":"22e18a2f-000f-5000-a000-1db6312b7767","status":"canceled","paid":false,"amount":{"value":"2.00","currency":"RUB"},"authorization_details":{"rrn":"603668680243","auth_code":"000000","three_d_secure":{"applied":true}},"created_at":"2018-07-18T17:33:35.737Z","description":"Заказ №72","metadata":{},"payment_method":{"type":"bank_card","id":"22e18a2f-000f-5000-a000-1db6312b7767","saved":false,"card":{"first6":"555555","last4":"4444","expiry_month":"07","expiry_year":"2022","card_type":"MasterCard","issuer_country":"RU","issuer_name":"Sberbank"},"title":"Bank card *4444"},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false,"cancellation_details":{"party":"merchant","reason":"canceled_by_merchant"}}`
+	var payment yandexkassa.Payment
+	if err := json.Unmarshal([]byte(canceled), &payment); err != nil {
+		t.Fatal(err)
+	}
+	want := &yandexkassa.CancellationDetails{Party: yandexkassa.CancellationPartyMerchant, Reason: yandexkassa.CancellationReasonCanceledByMerchant}
+	if !reflect.DeepEqual(payment.CancellationDetails, want) {
+		t.Fatalf("got cancellation details %+v", payment.CancellationDetails)
+	}
+	if payment.CancellationDetails.Reason.Description() != "Платеж отменен по API при оплате в две стадии" {
+		t.Fatalf("got description %q", payment.CancellationDetails.Reason.Description())
+	}
+	wantAuth := &yandexkassa.AuthorizationDetails{RRN: "603668680243", AuthCode: "000000", ThreeDSecure: yandexkassa.ThreeDSecure{Applied: true}}
+	if !reflect.DeepEqual(payment.AuthorizationDetails, wantAuth) {
+		t.Fatalf("got authorization details %+v", payment.AuthorizationDetails)
+	}
+
+	data, err := json.Marshal(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again yandexkassa.Payment
+	if err = json.Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, payment) {
+		t.Fatalf("round trip changed the payment:\n%+v\n%+v", payment, again)
+	}
+
+	if reason := yandexkassa.CancellationReason("new_reason"); reason.Description() != "new_reason" {
+		t.Fatalf("unknown reason described as %q", reason.Description())
+	}
+	if data, err = json.Marshal(yandexkassa.Payment{ID: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "cancellation_details") || strings.Contains(string(data), "authorization_details") {
+		t.Fatalf("empty details are sent: %s", data)
+	}
+}
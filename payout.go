@@ -0,0 +1,210 @@
+package yandexkassa
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+/*
+	Выплаты: перевод денег от магазина на карту, в кошелек ЮMoney или через СБП, например продавцу по безопасной сделке
+	или самозанятому. Выплата создается в статусе pending и переходит в succeeded или canceled, о чем Яндекс.Касса
+	сообщает уведомлениями payout.succeeded и payout.canceled (см. PayoutNotification).
+*/
+
+const (
+	PayoutStatusPending   = "pending"
+	PayoutStatusSucceeded = "succeeded"
+	PayoutStatusCanceled  = "canceled"
+)
+
+//Типы получателя выплаты (поле type в PayoutDestination)
+const (
+	PayoutDestinationBankCard = "bank_card"
+	PayoutDestinationYooMoney = "yoo_money"
+	PayoutDestinationSbp      = "sbp"
+)
+
+//Участники, которые отменяют выплату (PayoutCancellationDetails.Party)
+const (
+	PayoutCancellationPartyYooMoney      = "yoo_money"      //ЮMoney
+	PayoutCancellationPartyPayoutNetwork = "payout_network" //Банк или платежная система получателя
+)
+
+//Причины отмены выплаты (PayoutCancellationDetails.Reason)
+const (
+	PayoutCancellationReasonInsufficientFunds      = "insufficient_funds"      //Не хватает денег на балансе шлюза или сделки
+	PayoutCancellationReasonFraudSuspected         = "fraud_suspected"         //Выплата заблокирована из-за подозрения в мошенничестве
+	PayoutCancellationReasonOneTimeLimitExceeded   = "one_time_limit_exceeded" //Превышен лимит на разовое зачисление получателю
+	PayoutCancellationReasonPeriodicLimitExceeded  = "periodic_limit_exceeded" //Превышен лимит выплат получателю за период
+	PayoutCancellationReasonRejectedByPayee        = "rejected_by_payee"       //Эмитент карты или банк получателя отклонил выплату
+	PayoutCancellationReasonGeneralDecline         = "general_decline"         //Причина не детализирована
+	PayoutCancellationReasonIssuerUnavailable      = "issuer_unavailable"      //Банк получателя недоступен
+	PayoutCancellationReasonRecipientNotFound      = "recipient_not_found"     //Получатель не найден по номеру телефона (для sbp)
+	PayoutCancellationReasonRecipientCheckFailed   = "recipient_check_failed"  //Получатель не прошел проверку
+	PayoutCancellationReasonIdentificationRequired = "identification_required" //Кошелек ЮMoney получателя не идентифицирован
+	PayoutCancellationReasonSelfEmployedAnnulled   = "self_employed_annulled"  //Самозанятый снят с учета
+)
+
+//Кто отменил выплату и почему. Значения отличаются от причин отмены платежей, поэтому это отдельный тип
+type PayoutCancellationDetails struct {
+	Party  string `json:"party"`  //Участник, который отменил выплату, одна из констант PayoutCancellationParty*
+	Reason string `json:"reason"` //Причина отмены, одна из констант PayoutCancellationReason*
+}
+
+//Получатель выплаты. В запросе заполняется одно из полей в зависимости от Type, в ответе карта приходит без полного номера
+type PayoutDestination struct {
+	Type             string      `json:"type"`                        //Тип получателя: bank_card, yoo_money, sbp
+	Card             *PayoutCard `json:"card,omitempty"`              //Банковская карта для bank_card
+	AccountNumber    string      `json:"account_number,omitempty"`    //Номер кошелька ЮMoney для yoo_money
+	Phone            string      `json:"phone,omitempty"`             //Телефон получателя для sbp в формате ITU-T E.164, например 79000000000
+	BankID           string      `json:"bank_id,omitempty"`           //Идентификатор банка получателя для sbp (см. SbpBanks)
+	RecipientChecked bool        `json:"recipient_checked,omitempty"` //Для sbp в ответе: проверен ли получатель выплаты
+}
+
+type PayoutCard struct {
+	Number        string `json:"number,omitempty"`         //Номер карты. Передается только в запросе
+	First6        string `json:"first6,omitempty"`         //Первые 6 цифр номера карты (BIN)
+	Last4         string `json:"last4,omitempty"`          //Последние 4 цифры номера карты
+	CardType      string `json:"card_type,omitempty"`      //Тип банковской карты (например: MasterCard, Visa, Mir)
+	IssuerCountry string `json:"issuer_country,omitempty"` //Код страны, в которой выпущена карта, ISO-3166 alpha-2
+	IssuerName    string `json:"issuer_name,omitempty"`    //Наименование банка, выпустившего карту
+}
+
+//Сделка в выплате: выплата продавцу списывается с PayoutBalance сделки
+type PayoutDeal struct {
+	ID string `json:"id"` //Идентификатор сделки
+}
+
+type PayoutRequest struct {
+	Amount                Amount                 `json:"amount"`                            //Сумма выплаты
+	PayoutDestinationData *PayoutDestination     `json:"payout_destination_data,omitempty"` //Данные получателя. Указывается, если не передан PayoutToken
+	PayoutToken           string                 `json:"payout_token,omitempty"`            //Токен карты получателя из виджета выплат. Указывается, если не передан PayoutDestinationData
+	Description           string                 `json:"description,omitempty"`             //Описание выплаты, до 128 символов
+	Deal                  *PayoutDeal            `json:"deal,omitempty"`                    //Сделка, в рамках которой делается выплата
+	Metadata              map[string]interface{} `json:"metadata,omitempty"`                //Дополнительные данные выплаты
+	SelfEmployed          *PayoutSelfEmployed    `json:"self_employed,omitempty"`           //Самозанятый получатель выплаты. Чек за него регистрирует Яндекс.Касса
+	ReceiptData           *PayoutReceiptData     `json:"receipt_data,omitempty"`            //Данные для чека самозанятого. Обязательны, если указан SelfEmployed
+}
+
+type PayoutSelfEmployed struct {
+	ID string `json:"id"` //Идентификатор самозанятого в Яндекс.Кассе
+}
+
+type PayoutReceiptData struct {
+	ServiceName string  `json:"service_name"`     //Описание услуги, за которую платит магазин, до 50 символов
+	Amount      *Amount `json:"amount,omitempty"` //Сумма для чека, если она отличается от суммы выплаты
+}
+
+//Фильтр для получения списка выплат. Пустые поля не передаются
+type PayoutListFilter struct {
+	CreatedAt       TimeFilter //Фильтр по времени создания выплаты
+	DestinationType string     //Тип получателя (bank_card, yoo_money, sbp)
+	Status          string     //Статус выплаты (pending, succeeded, canceled)
+	Limit           int        //Размер выдачи результатов запроса, от 1 до 100
+	Cursor          string     //Указатель на следующий фрагмент списка (next_cursor из предыдущего ответа)
+}
+
+func (f *PayoutListFilter) values() url.Values {
+	values := url.Values{}
+	if f == nil {
+		return values
+	}
+	f.CreatedAt.encode(values)
+	setString(values, "payout_destination.type", f.DestinationType)
+	setString(values, "status", f.Status)
+	setInt(values, "limit", f.Limit)
+	setString(values, "cursor", f.Cursor)
+	return values
+}
+
+type PayoutList struct {
+	Type       string   `json:"type"`        //Формат выдачи результатов запроса (list)
+	Items      []Payout `json:"items"`       //Список выплат
+	NextCursor string   `json:"next_cursor"` //Указатель на следующий фрагмент списка. Отсутствует, если это последний фрагмент
+}
+
+//Банк — участник СБП, на счет в котором можно сделать выплату
+type SbpBank struct {
+	BankID string `json:"bank_id"` //Идентификатор банка для PayoutDestination.BankID
+	Name   string `json:"name"`    //Название банка
+	BIC    string `json:"bic"`     //БИК банка
+}
+
+type Payout struct {
+	ID                  string                     `json:"id"`                             //Идентификатор выплаты
+	Amount              Amount                     `json:"amount"`                         //Сумма выплаты
+	Status              string                     `json:"status"`                         //Статус выплаты: pending, succeeded или canceled
+	PayoutDestination   PayoutDestination          `json:"payout_destination"`             //Получатель выплаты
+	Description         string                     `json:"description,omitempty"`          //Описание выплаты
+	CreatedAt           string                     `json:"created_at"`                     //Время создания выплаты, ISO 8601 по UTC
+	Deal                *PayoutDeal                `json:"deal,omitempty"`                 //Сделка, в рамках которой сделана выплата
+	CancellationDetails *PayoutCancellationDetails `json:"cancellation_details,omitempty"` //Кто отменил выплату и по какой причине. Присутствует для статуса canceled
+	Metadata            map[string]interface{}     `json:"metadata,omitempty"`             //Дополнительные данные выплаты
+	SelfEmployed        *PayoutSelfEmployed        `json:"self_employed,omitempty"`        //Самозанятый получатель выплаты
+	ReceiptData         *PayoutReceiptData         `json:"receipt_data,omitempty"`         //Данные чека самозанятого
+	Test                bool                       `json:"test"`                           //Признак тестовой операции
+}
+
+//Время создания выплаты
+func (p *Payout) CreatedTime() (time.Time, error) {
+	return ParseTime(p.CreatedAt)
+}
+
+func (k *Kassa) CreatePayout(inputPayout *PayoutRequest) (*Payout, *Processing, error) {
+	var payout Payout
+	processing, err := k.do(http.MethodPost, "/payouts", inputPayout, &payout)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &payout, nil, nil
+}
+
+func (k *Kassa) PayoutInfo(payoutID string) (*Payout, *Processing, error) {
+	var payout Payout
+	processing, err := k.do(http.MethodGet, "/payouts/"+url.PathEscape(payoutID), nil, &payout)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &payout, nil, nil
+}
+
+func (k *Kassa) ListPayouts(filter *PayoutListFilter) (*PayoutList, *Processing, error) {
+	path := "/payouts"
+	if query := filter.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	var list PayoutList
+	processing, err := k.do(http.MethodGet, path, nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &list, nil, nil
+}
+
+//SbpBanks возвращает банки — участники СБП, в которые можно сделать выплату
+func (k *Kassa) SbpBanks() ([]SbpBank, *Processing, error) {
+	var list struct {
+		Items []SbpBank `json:"items"`
+	}
+	processing, err := k.do(http.MethodGet, "/sbp_banks", nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return list.Items, nil, nil
+}
+
+//PayoutNotification возвращает обработчик уведомлений о выплатах: succeedFunction вызывается для payout.succeeded,
+//cancelFunction — для payout.canceled. Уведомления о других событиях принимаются без обработки.
+//Если функция вернула ошибку, обработчик отвечает 500, и Яндекс.Касса повторит уведомление
+func (k *Kassa) PayoutNotification(succeedFunction, cancelFunction func(*Kassa, *Payout) error) http.HandlerFunc {
+	return k.DealNotification(nil, func(k *Kassa, payout *Payout) error {
+		switch {
+		case payout.Status == PayoutStatusSucceeded && succeedFunction != nil:
+			return succeedFunction(k, payout)
+		case payout.Status == PayoutStatusCanceled && cancelFunction != nil:
+			return cancelFunction(k, payout)
+		}
+		return nil
+	})
+}
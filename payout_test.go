@@ -0,0 +1,36 @@
+package yandexkassa_test
+
+import (
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func TestPayoutCancellationDetails(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+
+	payout, _, err := kassa.WithIdempotenceKey("payout-1").CreatePayout(&yandexkassa.PayoutRequest{
+		Amount: yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PayoutDestinationData: &yandexkassa.PayoutDestination{
+			Type: yandexkassa.PayoutDestinationBankCard,
+			Card: &yandexkassa.PayoutCard{Number: kassatest.DeclinedPayoutCard}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+
+	payout, _, err = kassa.PayoutInfo(payout.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payout.Status != yandexkassa.PayoutStatusCanceled || payout.CancellationDetails == nil {
+		t.Fatalf("payout is %s with %v", payout.Status, payout.CancellationDetails)
+	}
+	if payout.CancellationDetails.Party != yandexkassa.PayoutCancellationPartyPayoutNetwork ||
+		payout.CancellationDetails.Reason != yandexkassa.PayoutCancellationReasonRejectedByPayee {
+		t.Fatalf("got %+v", payout.CancellationDetails)
+	}
+}
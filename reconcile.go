@@ -0,0 +1,313 @@
+package yandexkassa
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+/*
+	Сверка локальных записей (Kassa.Store) с данными Яндекс.Кассы за период.
+	Платежи и возвраты сопоставляются по идентификатору, а платежи без совпадения по идентификатору —
+	по номеру заказа в Metadata. Результат — отчет с расхождениями, который можно выгрузить в CSV или JSON.
+*/
+
+var ErrNoStore = errors.New("yandexkassa: Kassa.Store is not set")
+
+//Ключ в Metadata платежа с номером заказа, по которому сверка сопоставляет платежи без совпадения по ID
+const DefaultOrderMetadataKey = "order_id"
+
+//Виды расхождений
+const (
+	DiscrepancyMissingLocally  = "missing_locally"  //Объект есть в Яндекс.Кассе, но не сохранен локально
+	DiscrepancyMissingRemotely = "missing_remotely" //Объект сохранен локально, но в Яндекс.Кассе его нет
+	DiscrepancyAmountMismatch  = "amount_mismatch"  //Суммы не совпадают
+	DiscrepancyStatusMismatch  = "status_mismatch"  //Статусы не совпадают
+)
+
+const (
+	ObjectPayment = "payment"
+	ObjectRefund  = "refund"
+)
+
+type Discrepancy struct {
+	Kind         string `json:"kind"`                    //Вид расхождения, одна из констант Discrepancy*
+	Object       string `json:"object"`                  //payment или refund
+	ID           string `json:"id"`                      //Идентификатор в Яндекс.Кассе (или локальный, если объекта нет в Яндекс.Кассе)
+	LocalID      string `json:"local_id,omitempty"`      //Локальный идентификатор, если объект сопоставлен по номеру заказа
+	OrderID      string `json:"order_id,omitempty"`      //Номер заказа из Metadata
+	LocalStatus  string `json:"local_status,omitempty"`  //Статус в локальной записи
+	RemoteStatus string `json:"remote_status,omitempty"` //Статус в Яндекс.Кассе
+	LocalAmount  Amount `json:"local_amount"`            //Сумма в локальной записи
+	RemoteAmount Amount `json:"remote_amount"`           //Сумма в Яндекс.Кассе
+}
+
+type ReconcileReport struct {
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	RemotePayments int           `json:"remote_payments"` //Платежей в Яндекс.Кассе за период
+	LocalPayments  int           `json:"local_payments"`  //Платежей в локальном хранилище за период
+	RemoteRefunds  int           `json:"remote_refunds"`
+	LocalRefunds   int           `json:"local_refunds"`
+	Discrepancies  []Discrepancy `json:"discrepancies"`
+}
+
+//Reconcile сверяет платежи и возвраты, созданные в промежутке [from, to), с записями в k.Store.
+//Номер заказа берется из Metadata по ключу k.OrderMetadataKey (если пустой — DefaultOrderMetadataKey)
+func (k *Kassa) Reconcile(ctx context.Context, from, to time.Time) (*ReconcileReport, error) {
+	if k.Store == nil {
+		return nil, ErrNoStore
+	}
+	orderMetadataKey := k.OrderMetadataKey
+	if orderMetadataKey == "" {
+		orderMetadataKey = DefaultOrderMetadataKey
+	}
+
+	//Списки запрашиваются без Store, иначе полученные объекты сразу попадут в локальное хранилище
+	remote := *k
+	remote.Store = nil
+
+	report := &ReconcileReport{From: from, To: to}
+
+	remotePayments, err := remote.allPayments(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	localPayments, err := k.Store.PaymentsCreated(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.RemotePayments, report.LocalPayments = len(remotePayments), len(localPayments)
+	report.reconcilePayments(remotePayments, localPayments, orderMetadataKey)
+
+	remoteRefunds, err := remote.allRefunds(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	localRefunds, err := k.Store.RefundsCreated(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.RemoteRefunds, report.LocalRefunds = len(remoteRefunds), len(localRefunds)
+	report.reconcileRefunds(remoteRefunds, localRefunds)
+
+	return report, nil
+}
+
+func (r *ReconcileReport) reconcilePayments(remote, local []Payment, orderMetadataKey string) {
+	remoteIDs := make(map[string]struct{}, len(remote))
+	for i := range remote {
+		remoteIDs[remote[i].ID] = struct{}{}
+	}
+
+	//По одному номеру заказа может быть несколько платежей, например после повторной попытки оплаты
+	localByID := map[string]*Payment{}
+	localByOrder := map[string][]*Payment{}
+	for i := range local {
+		localByID[local[i].ID] = &local[i]
+		if order := MetadataString(local[i].Metadata[orderMetadataKey]); order != "" {
+			localByOrder[order] = append(localByOrder[order], &local[i])
+		}
+	}
+
+	matched := map[string]bool{}
+	for i := range remote {
+		payment := &remote[i]
+		order := MetadataString(payment.Metadata[orderMetadataKey])
+
+		localPayment, ok := localByID[payment.ID]
+		if !ok && order != "" {
+			for _, candidate := range localByOrder[order] {
+				if _, sameID := remoteIDs[candidate.ID]; !sameID && !matched[candidate.ID] {
+					localPayment, ok = candidate, true
+					break
+				}
+			}
+		}
+		if !ok {
+			r.add(Discrepancy{Kind: DiscrepancyMissingLocally, Object: ObjectPayment, ID: payment.ID, OrderID: order,
+				RemoteStatus: payment.Status, RemoteAmount: payment.Amount})
+			continue
+		}
+		matched[localPayment.ID] = true
+
+		d := Discrepancy{Object: ObjectPayment, ID: payment.ID, OrderID: order,
+			LocalStatus: localPayment.Status, RemoteStatus: payment.Status,
+			LocalAmount: localPayment.Amount, RemoteAmount: payment.Amount}
+		if localPayment.ID != payment.ID {
+			d.LocalID = localPayment.ID
+		}
+		r.compare(d)
+	}
+
+	for i := range local {
+		if matched[local[i].ID] {
+			continue
+		}
+		r.add(Discrepancy{Kind: DiscrepancyMissingRemotely, Object: ObjectPayment, ID: local[i].ID,
+			OrderID:     MetadataString(local[i].Metadata[orderMetadataKey]),
+			LocalStatus: local[i].Status, LocalAmount: local[i].Amount})
+	}
+}
+
+func (r *ReconcileReport) reconcileRefunds(remote, local []Refund) {
+	localByID := map[string]*Refund{}
+	for i := range local {
+		localByID[local[i].ID] = &local[i]
+	}
+
+	matched := map[string]bool{}
+	for i := range remote {
+		refund := &remote[i]
+		localRefund, ok := localByID[refund.ID]
+		if !ok {
+			r.add(Discrepancy{Kind: DiscrepancyMissingLocally, Object: ObjectRefund, ID: refund.ID,
+				RemoteStatus: refund.Status, RemoteAmount: refund.Amount})
+			continue
+		}
+		matched[refund.ID] = true
+		r.compare(Discrepancy{Object: ObjectRefund, ID: refund.ID,
+			LocalStatus: localRefund.Status, RemoteStatus: refund.Status,
+			LocalAmount: localRefund.Amount, RemoteAmount: refund.Amount})
+	}
+
+	for i := range local {
+		if !matched[local[i].ID] {
+			r.add(Discrepancy{Kind: DiscrepancyMissingRemotely, Object: ObjectRefund, ID: local[i].ID,
+				LocalStatus: local[i].Status, LocalAmount: local[i].Amount})
+		}
+	}
+}
+
+//compare добавляет расхождения по сумме и статусу для сопоставленной пары
+func (r *ReconcileReport) compare(d Discrepancy) {
+	if !sameAmount(d.LocalAmount, d.RemoteAmount) {
+		d.Kind = DiscrepancyAmountMismatch
+		r.add(d)
+	}
+	if d.LocalStatus != d.RemoteStatus {
+		d.Kind = DiscrepancyStatusMismatch
+		r.add(d)
+	}
+}
+
+func (r *ReconcileReport) add(d Discrepancy) {
+	r.Discrepancies = append(r.Discrepancies, d)
+}
+
+//WriteJSON выгружает отчет в JSON
+func (r *ReconcileReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+//WriteCSV выгружает расхождения в CSV, по одной строке на расхождение
+func (r *ReconcileReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"kind", "object", "id", "local_id", "order_id", "local_status", "remote_status",
+		"local_amount", "remote_amount", "currency"})
+	for _, d := range r.Discrepancies {
+		currency := d.RemoteAmount.Currency
+		if currency == "" {
+			currency = d.LocalAmount.Currency
+		}
+		writer.Write([]string{d.Kind, d.Object, d.ID, d.LocalID, d.OrderID, d.LocalStatus, d.RemoteStatus,
+			d.LocalAmount.Value, d.RemoteAmount.Value, currency})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func sameAmount(a, b Amount) bool {
+	if a.Currency != b.Currency {
+		return false
+	}
+	unitsA, errA := a.MinorUnits()
+	unitsB, errB := b.MinorUnits()
+	if errA != nil || errB != nil {
+		return a.Value == b.Value
+	}
+	return unitsA == unitsB
+}
+
+func (k *Kassa) allPayments(ctx context.Context, from, to time.Time) ([]Payment, error) {
+	var payments []Payment
+	filter := &PaymentListFilter{CreatedAt: TimeFilter{Gte: from, Lt: to}, Limit: 100}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		list, processing, err := k.ListPaymentsContext(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if processing != nil {
+			if err = sleepContext(ctx, retryDelay(processing)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		payments = append(payments, list.Items...)
+		if list.NextCursor == "" {
+			return payments, nil
+		}
+		filter.Cursor = list.NextCursor
+	}
+}
+
+func (k *Kassa) allRefunds(ctx context.Context, from, to time.Time) ([]Refund, error) {
+	var refunds []Refund
+	filter := &RefundListFilter{CreatedAt: TimeFilter{Gte: from, Lt: to}, Limit: 100}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		list, processing, err := k.ListRefundsContext(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if processing != nil {
+			if err = sleepContext(ctx, retryDelay(processing)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		refunds = append(refunds, list.Items...)
+		if list.NextCursor == "" {
+			return refunds, nil
+		}
+		filter.Cursor = list.NextCursor
+	}
+}
+
+func createdBetween(createdAt string, from, to time.Time) bool {
+	created, err := ParseTime(createdAt)
+	if err != nil || created.IsZero() {
+		return false
+	}
+	return !created.Before(from) && created.Before(to)
+}
+
+//retryDelay возвращает, через сколько повторить запрос после ответа 202. Не меньше секунды
+func retryDelay(processing *Processing) time.Duration {
+	delay := time.Duration(processing.RetryAfter) * time.Millisecond
+	if delay < time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package yandexkassa_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func TestReconcile(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	store := yandexkassa.NewMemoryStore()
+	kassa := srv.Kassa()
+	kassa.Store = store
+	kassa.OrderMetadataKey = "invoice"
+	now := time.Now()
+
+	_, _, err := kassa.WithIdempotenceKey("stored").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Платеж создан, но ответ не дошел до магазина: локально он записан под своим номером заказа
+	_, _, err = srv.Kassa().WithIdempotenceKey("lost").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "20.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{},
+		Metadata:          map[string]interface{}{"invoice": "7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SavePayment(&yandexkassa.Payment{ID: "local-7", Status: yandexkassa.PaymentStatusPending,
+		Amount: yandexkassa.Amount{Value: "20.00", Currency: "RUB"}, CreatedAt: yandexkassa.FormatTime(now),
+		Metadata: map[string]interface{}{"invoice": "7"}})
+
+	//Платеж в статусе, которого нет среди известных, тоже участвует в сверке
+	store.SavePayment(&yandexkassa.Payment{ID: "gone", Status: "expired",
+		Amount: yandexkassa.Amount{Value: "5.00", Currency: "RUB"}, CreatedAt: yandexkassa.FormatTime(now)})
+
+	report, err := kassa.Reconcile(context.Background(), now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RemotePayments != 2 || report.LocalPayments != 3 {
+		t.Fatalf("got %d remote and %d local payments, want 2 and 3", report.RemotePayments, report.LocalPayments)
+	}
+	if len(report.Discrepancies) != 1 {
+		t.Fatalf("got discrepancies %+v, want one for the payment missing remotely", report.Discrepancies)
+	}
+	d := report.Discrepancies[0]
+	if d.Kind != yandexkassa.DiscrepancyMissingRemotely || d.ID != "gone" {
+		t.Fatalf("got %+v", d)
+	}
+}
+
+type contextKey struct{}
+
+//contextTransport проверяет, что запросы отправляются с контекстом вызова
+type contextTransport struct {
+	t *testing.T
+}
+
+func (c contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(contextKey{}) == nil {
+		c.t.Errorf("%s %s is sent without the caller's context", req.Method, req.URL.Path)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestReconcilePassesContext(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+	kassa.Store = yandexkassa.NewMemoryStore()
+	kassa.HTTPClient = &http.Client{Transport: contextTransport{t}}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, true)
+	if _, err := kassa.Reconcile(ctx, time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := kassa.Reconcile(canceled, time.Now().Add(-time.Hour), time.Now()); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestReconcileRetriedOrder(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	store := yandexkassa.NewMemoryStore()
+	kassa := srv.Kassa()
+	kassa.Store = store
+	now := time.Now()
+
+	//Заказ оплачивали дважды, оба ответа не дошли до магазина, а номер заказа записан числом
+	for _, key := range []string{"attempt-1", "attempt-2"} {
+		_, _, err := srv.Kassa().WithIdempotenceKey(key).CreatePayment(&yandexkassa.PaymentRequest{
+			Amount:            yandexkassa.Amount{Value: "20.00", Currency: "RUB"},
+			PaymentMethodData: yandexkassa.BankCardData{},
+			Metadata:          map[string]interface{}{yandexkassa.DefaultOrderMetadataKey: 8}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"local-8a", "local-8b"} {
+		store.SavePayment(&yandexkassa.Payment{ID: id, Status: yandexkassa.PaymentStatusPending,
+			Amount: yandexkassa.Amount{Value: "20.00", Currency: "RUB"}, CreatedAt: yandexkassa.FormatTime(now),
+			Metadata: map[string]interface{}{yandexkassa.DefaultOrderMetadataKey: float64(8)}})
+	}
+
+	report, err := kassa.Reconcile(context.Background(), now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Fatalf("got discrepancies %+v, want both payments matched by order", report.Discrepancies)
+	}
+}
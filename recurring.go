@@ -0,0 +1,166 @@
+package yandexkassa
+
+import (
+	"errors"
+	"sync"
+)
+
+/*
+	Повторные (рекуррентные) платежи: списание с сохраненного способа оплаты без участия пользователя.
+	Способ оплаты сохраняется, если первый платеж создан с SavePaymentMethod = true и пользователь его подтвердил.
+*/
+
+var (
+	ErrMethodNotFound         = errors.New("yandexkassa: saved payment method not found")
+	ErrMethodUnusable         = errors.New("yandexkassa: saved payment method is unusable")
+	ErrNoChargeIdempotenceKey = errors.New("yandexkassa: charge requires its own idempotence key")
+)
+
+//Ключ в Metadata платежа, в котором Recurring передает идентификатор покупателя, если не задан другой
+const DefaultCustomerMetadataKey = "customer_id"
+
+type SavedMethod struct {
+	CustomerID string //Идентификатор покупателя в вашей системе
+	MethodID   string //Идентификатор сохраненного способа оплаты (payment_method.id)
+	Type       string //Тип способа оплаты, одна из констант PaymentMethod*
+	Title      string //Название способа оплаты, например «Bank card *4444»
+	Usable     bool   //Можно ли проводить по нему безакцептные списания. Сбрасывается, если пользователь отозвал разрешение
+}
+
+//Хранилище сохраненных способов оплаты покупателей
+type SavedMethodStore interface {
+	SaveMethod(method SavedMethod) error                      //Добавляет или обновляет способ оплаты
+	Method(customerID, methodID string) (*SavedMethod, error) //Возвращает способ оплаты покупателя или ErrMethodNotFound
+	CustomerMethods(customerID string) ([]SavedMethod, error) //Все способы оплаты покупателя
+	MarkUnusable(methodID string) error                       //Запрещает списания со способа оплаты
+}
+
+type Recurring struct {
+	Kassa               *Kassa
+	Store               SavedMethodStore
+	CustomerMetadataKey string //Ключ в Metadata платежа для идентификатора покупателя. По умолчанию DefaultCustomerMetadataKey
+}
+
+//Charge списывает деньги с сохраненного способа оплаты покупателя без подтверждения пользователем.
+//В paymentRequest достаточно указать Amount, Description и, при необходимости, Capture, Receipt и Metadata;
+//без Capture платеж останется в waiting_for_capture. idempotenceKey обязателен и должен быть своим для каждого списания
+//(например, из номера счета): с общим ключом Kassa второе списание вернуло бы первый платеж.
+//Если платеж отменен из-за того, что пользователь отозвал разрешение (permission_revoked), способ оплаты помечается неиспользуемым
+func (r *Recurring) Charge(customerID, methodID, idempotenceKey string, paymentRequest *PaymentRequest) (*Payment, *Processing, error) {
+	if idempotenceKey == "" {
+		return nil, nil, ErrNoChargeIdempotenceKey
+	}
+	method, err := r.Store.Method(customerID, methodID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !method.Usable {
+		return nil, nil, ErrMethodUnusable
+	}
+
+	request := *paymentRequest
+	request.PaymentMethodId = methodID
+	request.PaymentMethodData = nil
+	request.PaymentToken = ""
+	request.Confirmation = Confirmation{}
+	request.SavePaymentMethod = false
+	request.Metadata = map[string]interface{}{}
+	for key, value := range paymentRequest.Metadata {
+		request.Metadata[key] = value
+	}
+	request.Metadata[r.customerMetadataKey()] = customerID
+
+	payment, processing, err := r.Kassa.WithIdempotenceKey(idempotenceKey).CreatePayment(&request)
+	if err != nil || processing != nil {
+		return payment, processing, err
+	}
+	return payment, nil, r.Track(payment)
+}
+
+//Track обновляет хранилище по платежу из ответа API или уведомления: сохраняет новый способ оплаты
+//после успешного платежа с SavePaymentMethod и помечает способ неиспользуемым при отмене с причиной permission_revoked
+func (r *Recurring) Track(payment *Payment) error {
+	if payment.PaymentMethod == nil {
+		return nil
+	}
+	common := payment.PaymentMethod.Common()
+
+	if IsPermissionRevoked(payment) {
+		return r.Store.MarkUnusable(common.ID)
+	}
+
+	customerID, _ := payment.Metadata[r.customerMetadataKey()].(string)
+	if payment.Status == PaymentStatusSucceeded && common.Saved && customerID != "" {
+		return r.Store.SaveMethod(SavedMethod{
+			CustomerID: customerID,
+			MethodID:   common.ID,
+			Type:       payment.PaymentMethod.Type(),
+			Title:      common.Title,
+			Usable:     true})
+	}
+	return nil
+}
+
+func (r *Recurring) customerMetadataKey() string {
+	if r.CustomerMetadataKey != "" {
+		return r.CustomerMetadataKey
+	}
+	return DefaultCustomerMetadataKey
+}
+
+//IsPermissionRevoked сообщает, что платеж отменен, потому что пользователь отозвал разрешение на автоплатежи
+func IsPermissionRevoked(payment *Payment) bool {
+	return payment.Status == PaymentStatusCanceled && payment.CancellationDetails != nil &&
+		payment.CancellationDetails.Reason == CancellationReasonPermissionRevoked
+}
+
+//Хранилище способов оплаты в памяти процесса. Подходит для тестов и небольших сервисов
+type MemorySavedMethodStore struct {
+	mu      sync.Mutex
+	methods map[string]SavedMethod
+}
+
+func NewMemorySavedMethodStore() *MemorySavedMethodStore {
+	return &MemorySavedMethodStore{methods: map[string]SavedMethod{}}
+}
+
+func (s *MemorySavedMethodStore) SaveMethod(method SavedMethod) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[method.MethodID] = method
+	return nil
+}
+
+func (s *MemorySavedMethodStore) Method(customerID, methodID string) (*SavedMethod, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	method, ok := s.methods[methodID]
+	if !ok || method.CustomerID != customerID {
+		return nil, ErrMethodNotFound
+	}
+	return &method, nil
+}
+
+func (s *MemorySavedMethodStore) CustomerMethods(customerID string) ([]SavedMethod, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var methods []SavedMethod
+	for _, method := range s.methods {
+		if method.CustomerID == customerID {
+			methods = append(methods, method)
+		}
+	}
+	return methods, nil
+}
+
+func (s *MemorySavedMethodStore) MarkUnusable(methodID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	method, ok := s.methods[methodID]
+	if !ok {
+		return ErrMethodNotFound
+	}
+	method.Usable = false
+	s.methods[methodID] = method
+	return nil
+}
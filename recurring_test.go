@@ -0,0 +1,165 @@
+package yandexkassa_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//savedMethod проводит первый платеж с сохранением способа оплаты и возвращает Recurring, в котором он сохранен
+func savedMethod(t *testing.T, srv *kassatest.Server) (*yandexkassa.Recurring, string) {
+	t.Helper()
+	recurring := &yandexkassa.Recurring{Kassa: srv.Kassa(), Store: yandexkassa.NewMemorySavedMethodStore()}
+	payment, _, err := srv.Kassa().WithIdempotenceKey("first").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{},
+		SavePaymentMethod: true,
+		Capture:           true,
+		Metadata:          map[string]interface{}{yandexkassa.DefaultCustomerMetadataKey: "c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	payment, _, err = srv.Kassa().PaymentInfo(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recurring.Track(payment); err != nil {
+		t.Fatal(err)
+	}
+	return recurring, payment.PaymentMethod.Common().ID
+}
+
+func TestChargeRequiresIdempotenceKey(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	recurring, methodID := savedMethod(t, srv)
+
+	request := &yandexkassa.PaymentRequest{Amount: yandexkassa.Amount{Value: "5.00", Currency: "RUB"}}
+	if _, _, err := recurring.Charge("c1", methodID, "", request); err != yandexkassa.ErrNoChargeIdempotenceKey {
+		t.Fatalf("got %v, want ErrNoChargeIdempotenceKey", err)
+	}
+
+	first, _, err := recurring.Charge("c1", methodID, "invoice-1", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := recurring.Charge("c1", methodID, "invoice-2", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("two charges returned the same payment %s", first.ID)
+	}
+}
+
+func TestChargeKeepsCapture(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	recurring, methodID := savedMethod(t, srv)
+
+	for _, capture := range []bool{false, true} {
+		key := "hold"
+		want := yandexkassa.PaymentStatusWaitingForCapture
+		if capture {
+			key, want = "capture", yandexkassa.PaymentStatusSucceeded
+		}
+		payment, _, err := recurring.Charge("c1", methodID, key, &yandexkassa.PaymentRequest{
+			Amount:  yandexkassa.Amount{Value: "5.00", Currency: "RUB"},
+			Capture: capture})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payment.Status != want {
+			t.Errorf("Capture=%t: status %s, want %s", capture, payment.Status, want)
+		}
+	}
+}
+
+func TestSavedMethodKeepsType(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	recurring, methodID := savedMethod(t, srv)
+
+	method, err := recurring.Store.Method("c1", methodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method.Type != yandexkassa.PaymentMethodBankCard {
+		t.Fatalf("saved method type %q, want %q", method.Type, yandexkassa.PaymentMethodBankCard)
+	}
+}
+
+func TestChargePermissionRevoked(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	recurring, methodID := savedMethod(t, srv)
+	srv.ScriptMetadata("invoice", "revoked", kassatest.Decline(yandexkassa.CancellationReasonPermissionRevoked))
+
+	//Отмена приходит уведомлением, которое обработчик магазина передает в Track
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification yandexkassa.Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+			return
+		}
+		payment, err := notification.Payment()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err = recurring.Track(payment); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer hook.Close()
+	srv.WebhookURL = hook.URL
+
+	payment, _, err := recurring.Charge("c1", methodID, "invoice-revoked", &yandexkassa.PaymentRequest{
+		Amount:   yandexkassa.Amount{Value: "5.00", Currency: "RUB"},
+		Capture:  true,
+		Metadata: map[string]interface{}{"invoice": "revoked"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+	if errs := srv.WebhookErrors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if payment, _, err = srv.Kassa().PaymentInfo(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !yandexkassa.IsPermissionRevoked(payment) {
+		t.Fatalf("payment is %s with %+v, want canceled with permission_revoked", payment.Status, payment.CancellationDetails)
+	}
+	method, err := recurring.Store.Method("c1", methodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method.Usable {
+		t.Fatal("method is still usable after permission_revoked")
+	}
+	_, _, err = recurring.Charge("c1", methodID, "invoice-next", &yandexkassa.PaymentRequest{
+		Amount: yandexkassa.Amount{Value: "5.00", Currency: "RUB"}})
+	if err != yandexkassa.ErrMethodUnusable {
+		t.Fatalf("got %v, want ErrMethodUnusable", err)
+	}
+}
+
+func TestChargeOmitsConfirmation(t *testing.T) {
+	data, err := json.Marshal(yandexkassa.PaymentRequest{PaymentMethodId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "confirmation") {
+		t.Fatalf("empty confirmation is sent: %s", data)
+	}
+}
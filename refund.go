@@ -1,139 +1,126 @@
 package yandexkassa
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"context"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
+	RefundStatusPending   = "pending"
 	RefundStatusCanceled  = "canceled"
 	RefundStatusSucceeded = "succeeded"
 )
 
 type RefundRequest struct {
-	PaymentID   string  `json:"payment_id"`  //Идентификатор платежа
-	Amount      Amount  `json:"amount"`      //Сумма, которую нужно вернуть пользователю.
-	Description string  `json:"description"` //Комментарий к возврату, основание для возврата денег пользователю
-	Receipt     Receipt `json:"receipt"`     //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
+	PaymentID   string         `json:"payment_id"`        //Идентификатор платежа
+	Amount      Amount         `json:"amount"`            //Сумма, которую нужно вернуть пользователю.
+	Description string         `json:"description"`       //Комментарий к возврату, основание для возврата денег пользователю
+	Receipt     Receipt        `json:"receipt"`           //Данные для формирования чека в онлайн-кассе (для соблюдения 54-ФЗ). Необходимо указать что-то одно — телефон пользователя (phone) или его электронную почту (email)
+	Sources     []RefundSource `json:"sources,omitempty"` //Из средств каких магазинов-продавцов делается возврат (для платежей с переводами). Сумма должна быть равна Amount
+	Deal        *RefundDeal    `json:"deal,omitempty"`    //Расчеты по безопасной сделке, к которой относится платеж
 }
 
 type Refund struct {
-	ID                  string `json:"id"`                   //Идентификатор возврата платежа в Яндекс.Кассе
-	PaymentID           string `json:"payment_id"`           //Идентификатор платежа
-	Status              string `json:"status"`               //Статус возврата платежа. Возможне значения: canceled, succeeded
-	CreatedAt           string `json:"created_at"`           //Время создания возврата. Указывается по UTC и передается в формате ISO 8601, например 2017-11-03T11:52:31.827Z
-	Amount              Amount `json:"amount"`               //Сумма, возвращенная пользователю
-	ReceiptRegistration string `json:"receipt_registration"` //Статус доставки данных для чека в онлайн-кассу (pending, succeeded или canceled). Присутствует, если вы используете решение Яндекс.Кассы для работы по 54-ФЗ
-	Description         string `json:"description"`          //Основание для возврата денег пользователю
+	ID                  string         `json:"id"`                      //Идентификатор возврата платежа в Яндекс.Кассе
+	PaymentID           string         `json:"payment_id"`              //Идентификатор платежа
+	Status              string         `json:"status"`                  //Статус возврата платежа. Возможне значения: canceled, succeeded
+	CreatedAt           string         `json:"created_at"`              //Время создания возврата. Указывается по UTC и передается в формате ISO 8601, например 2017-11-03T11:52:31.827Z
+	Amount              Amount         `json:"amount"`                  //Сумма, возвращенная пользователю
+	ReceiptRegistration string         `json:"receipt_registration"`    //Статус доставки данных для чека в онлайн-кассу (pending, succeeded или canceled). Присутствует, если вы используете решение Яндекс.Кассы для работы по 54-ФЗ
+	Description         string         `json:"description"`             //Основание для возврата денег пользователю
+	Sources             []RefundSource `json:"sources,omitempty"`       //Магазины-продавцы, из средств которых сделан возврат
+	Deal                *RefundDeal    `json:"deal,omitempty"`          //Безопасная сделка и расчеты по ней
+	RefundMethod        *RefundMethod  `json:"refund_method,omitempty"` //Способ возврата. Присутствует для возвратов через СБП
 }
 
-func (k *Kassa) CreateRefund(inputRefund RefundRequest) (*Refund, *Processing, error) {
-	const url = "https://payment.yandex.net/api/v3/refunds"
+//Время создания возврата
+func (r *Refund) CreatedTime() (time.Time, error) {
+	return ParseTime(r.CreatedAt)
+}
 
-	serializedRefund, err := json.Marshal(inputRefund)
-	if err != nil {
-		return nil, nil, err
-	}
+//Фильтр для получения списка возвратов. Пустые поля не передаются
+type RefundListFilter struct {
+	CreatedAt TimeFilter //Фильтр по времени создания возврата
+	PaymentID string     //Идентификатор платежа
+	Status    string     //Статус возврата (canceled, succeeded)
+	Limit     int        //Размер выдачи результатов запроса, от 1 до 100
+	Cursor    string     //Указатель на следующий фрагмент списка (next_cursor из предыдущего ответа)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(serializedRefund))
-	if err != nil {
-		return nil, nil, err
+func (f *RefundListFilter) values() url.Values {
+	values := url.Values{}
+	if f == nil {
+		return values
 	}
+	f.CreatedAt.encode(values)
+	setString(values, "payment_id", f.PaymentID)
+	setString(values, "status", f.Status)
+	setInt(values, "limit", f.Limit)
+	setString(values, "cursor", f.Cursor)
+	return values
+}
 
-	req.SetBasicAuth(k.IdempotenceKey, k.SecretKey)
-	req.Header.Set("Idempotence-Key", k.IdempotenceKey)
-	req.Header.Set("Content-Type", "application/json")
+type RefundList struct {
+	Type       string   `json:"type"`        //Формат выдачи результатов запроса (list)
+	Items      []Refund `json:"items"`       //Список возвратов
+	NextCursor string   `json:"next_cursor"` //Указатель на следующий фрагмент списка. Отсутствует, если это последний фрагмент
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
+//CreateRefund создает возврат. Если у Kassa указан RefundGuard, перед возвратом проверяется остаток платежа
+func (k *Kassa) CreateRefund(inputRefund RefundRequest) (*Refund, *Processing, error) {
+	if k.RefundGuard != nil {
+		return k.RefundGuard.createRefund(k, inputRefund)
 	}
-	defer resp.Body.Close()
+	return k.createRefund(inputRefund)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+func (k *Kassa) createRefund(inputRefund RefundRequest) (*Refund, *Processing, error) {
+	if err := ValidateRefundSources(inputRefund.Amount, inputRefund.Sources); err != nil {
 		return nil, nil, err
 	}
-
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var refund Refund
-		err = json.Unmarshal(body, &refund)
-		if err != nil {
-			return nil, nil, err
-		}
-		return &refund, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, &yandexError
+	var refund Refund
+	processing, err := k.do(http.MethodPost, "/refunds", &inputRefund, &refund)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
+	k.keepRefund(&refund)
+	return &refund, nil, nil
 }
 
 func (k *Kassa) RefundInfo(refundId string) (*Refund, *Processing, error) {
-	url := fmt.Sprintf("https://payment.yandex.net/api/v3/refunds/%s", refundId)
+	return k.RefundInfoContext(context.Background(), refundId)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, nil, err
+//RefundInfoContext — RefundInfo с контекстом: запрос прерывается, когда ctx завершается
+func (k *Kassa) RefundInfoContext(ctx context.Context, refundId string) (*Refund, *Processing, error) {
+	var refund Refund
+	processing, err := k.doContext(ctx, http.MethodGet, "/refunds/"+url.PathEscape(refundId), nil, &refund)
+	if err != nil || processing != nil {
+		return nil, processing, err
 	}
-	req.SetBasicAuth(k.IdempotenceKey, k.SecretKey)
+	k.keepRefund(&refund)
+	return &refund, nil, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer resp.Body.Close()
+func (k *Kassa) ListRefunds(filter *RefundListFilter) (*RefundList, *Processing, error) {
+	return k.ListRefundsContext(context.Background(), filter)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
+//ListRefundsContext — ListRefunds с контекстом: запрос прерывается, когда ctx завершается
+func (k *Kassa) ListRefundsContext(ctx context.Context, filter *RefundListFilter) (*RefundList, *Processing, error) {
+	path := "/refunds"
+	if query := filter.values().Encode(); query != "" {
+		path += "?" + query
 	}
-
-	switch resp.StatusCode {
-
-	case http.StatusOK:
-		var refund Refund
-		err = json.Unmarshal(body, &refund)
-		if err != nil {
-			return nil, nil, err
-		}
-		return &refund, nil, err
-
-	case http.StatusAccepted:
-		var proc Processing
-		err = json.Unmarshal(body, &proc)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		return nil, &proc, nil
-
-	default:
-		var yandexError Error
-		err = json.Unmarshal(body, &yandexError)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, &yandexError
+	var list RefundList
+	processing, err := k.doContext(ctx, http.MethodGet, path, nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	for i := range list.Items {
+		k.keepRefund(&list.Items[i])
 	}
+	return &list, nil, nil
 }
@@ -0,0 +1,250 @@
+package yandexkassa
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Проверка остатка платежа перед возвратом. Вернуть можно только сумму успешного платежа за вычетом уже возвращенной
+	(Payment.RefundedAmount). RefundGuard дополнительно учитывает возвраты, которые он сам создал и которые еще в статусе pending,
+	и не дает одновременно отправить несколько частичных возвратов одного платежа на сумму больше остатка.
+
+	Возврат, на создание которого API ответил 202 или временной ошибкой, учитывается до тех пор, пока не станет известен
+	его результат. RefundGuard узнает его только запросами на чтение (списком возвратов платежа) и никогда не отправляет
+	такой запрос повторно сам: повторить его с тем же ключом идемпотентности может только вызывающий код.
+*/
+
+var ErrRefundExceedsBalance = errors.New("yandexkassa: refund amount exceeds the refundable balance of the payment")
+
+//RefundableAmount возвращает сумму, которую еще можно вернуть по платежу. Для неуспешных платежей это ноль
+func RefundableAmount(payment *Payment) (Amount, error) {
+	if payment.Status != PaymentStatusSucceeded {
+		return NewAmount(0, payment.Amount.Currency), nil
+	}
+	paid, err := payment.Amount.MinorUnits()
+	if err != nil {
+		return Amount{}, err
+	}
+	var refunded int64
+	if payment.RefundedAmount.Value != "" {
+		if refunded, err = payment.RefundedAmount.MinorUnits(); err != nil {
+			return Amount{}, err
+		}
+	}
+	if refunded > paid {
+		refunded = paid
+	}
+	return NewAmount(paid-refunded, payment.Amount.Currency), nil
+}
+
+//RefundGuard проверяет возвраты перед отправкой. Возвраты одного платежа отправляются по очереди, разных платежей — параллельно.
+//Нулевое значение готово к использованию; один RefundGuard можно указать у нескольких копий Kassa
+type RefundGuard struct {
+	mu       sync.Mutex
+	payments map[string]*refundBalance
+}
+
+type refundBalance struct {
+	sync.Mutex
+	users      int                         //Сколько вызовов сейчас используют запись. Запись без вызовов и незавершенных возвратов удаляется
+	pending    map[string]int64            //Созданные, но еще не завершенные возвраты: ID возврата -> сумма в копейках
+	processing map[string]processingRefund //Возвраты, результат создания которых неизвестен: ключ идемпотентности -> запрос
+	created    map[string]bool             //Возвраты, созданные через RefundGuard, пока есть возвраты с неизвестным результатом. Их нельзя принять за такой возврат
+}
+
+type processingRefund struct {
+	amount  int64
+	request RefundRequest
+	sent    time.Time //Время отправки запроса
+}
+
+//Допустимое расхождение часов магазина и Яндекс.Кассы при поиске возврата, результат создания которого неизвестен
+const refundClockSkew = time.Minute
+
+//Pending возвращает сумму возвратов платежа, созданных через RefundGuard и еще не завершенных (по последним известным данным),
+//включая возвраты, результат создания которых неизвестен
+func (g *RefundGuard) Pending(paymentID string) int64 {
+	balance := g.acquire(paymentID)
+	defer g.release(paymentID, balance)
+	balance.Lock()
+	defer balance.Unlock()
+
+	return balance.totalLocked()
+}
+
+func (b *refundBalance) totalLocked() int64 {
+	var total int64
+	for _, amount := range b.pending {
+		total += amount
+	}
+	for _, p := range b.processing {
+		total += p.amount
+	}
+	return total
+}
+
+func (g *RefundGuard) createRefund(k *Kassa, inputRefund RefundRequest) (*Refund, *Processing, error) {
+	amount, err := inputRefund.Amount.MinorUnits()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	balance := g.acquire(inputRefund.PaymentID)
+	defer g.release(inputRefund.PaymentID, balance)
+	balance.Lock()
+	defer balance.Unlock()
+
+	balance.refreshLocked(k, inputRefund)
+
+	payment, processing, err := k.PaymentInfo(inputRefund.PaymentID)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	if payment.Status != PaymentStatusSucceeded {
+		return nil, nil, fmt.Errorf("yandexkassa: payment %s is in status %s and can't be refunded", payment.ID, payment.Status)
+	}
+	if inputRefund.Amount.Currency != payment.Amount.Currency {
+		return nil, nil, fmt.Errorf("yandexkassa: refund currency %s differs from payment currency %s", inputRefund.Amount.Currency, payment.Amount.Currency)
+	}
+
+	refundable, err := RefundableAmount(payment)
+	if err != nil {
+		return nil, nil, err
+	}
+	available, _ := refundable.MinorUnits()
+	if amount > available-balance.totalLocked() {
+		return nil, nil, ErrRefundExceedsBalance
+	}
+
+	sent := time.Now()
+	refund, processing, err := k.createRefund(inputRefund)
+	switch {
+	case processing != nil || (err != nil && temporaryError(err)):
+		if k.IdempotenceKey != "" {
+			balance.processing[k.IdempotenceKey] = processingRefund{amount: amount, request: inputRefund, sent: sent}
+		}
+	case err == nil:
+		if refund.Status == RefundStatusPending {
+			balance.pending[refund.ID] = amount
+		}
+		if len(balance.processing) > 0 {
+			balance.created[refund.ID] = true
+		}
+	}
+	return refund, processing, err
+}
+
+//refreshLocked убирает завершившиеся возвраты. Если inputRefund — повтор запроса с неизвестным результатом
+//(тот же ключ идемпотентности и те же данные), он убирается из учета, потому что вызывающий код отправит его сейчас
+func (b *refundBalance) refreshLocked(k *Kassa, inputRefund RefundRequest) {
+	for key, p := range b.processing {
+		if key == k.IdempotenceKey && reflect.DeepEqual(p.request, inputRefund) {
+			delete(b.processing, key)
+		}
+	}
+	if len(b.processing) > 0 {
+		b.findProcessingLocked(k, inputRefund.PaymentID)
+	}
+	if len(b.processing) == 0 {
+		b.created = map[string]bool{}
+	}
+	for refundID := range b.pending {
+		refund, processing, err := k.RefundInfo(refundID)
+		if err == nil && processing == nil && refund.Status != RefundStatusPending {
+			delete(b.pending, refundID)
+		}
+	}
+}
+
+//findProcessingLocked ищет в списке возвратов платежа возвраты, результат создания которых был неизвестен.
+//Возврату соответствует новый возврат на ту же сумму, созданный не раньше отправки запроса. Если такого нет,
+//сумма остается в учете, пока ключ идемпотентности действует (IdempotenceKeyLifetime)
+func (b *refundBalance) findProcessingLocked(k *Kassa, paymentID string) {
+	keys := make([]string, 0, len(b.processing))
+	for key := range b.processing {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return b.processing[keys[i]].sent.Before(b.processing[keys[j]].sent) })
+
+	refunds, err := paymentRefunds(k, paymentID, b.processing[keys[0]].sent.Add(-refundClockSkew))
+	if err != nil {
+		return
+	}
+	claimed := map[string]bool{}
+	for refundID := range b.created {
+		claimed[refundID] = true
+	}
+	for refundID := range b.pending {
+		claimed[refundID] = true
+	}
+
+	for _, key := range keys {
+		p := b.processing[key]
+		for i := range refunds {
+			refund := &refunds[i]
+			units, err := refund.Amount.MinorUnits()
+			created, _ := refund.CreatedTime()
+			if claimed[refund.ID] || err != nil || units != p.amount || created.Before(p.sent.Add(-refundClockSkew)) {
+				continue
+			}
+			claimed[refund.ID] = true
+			if refund.Status == RefundStatusPending {
+				b.pending[refund.ID] = p.amount
+			}
+			delete(b.processing, key)
+			break
+		}
+		if _, ok := b.processing[key]; ok && time.Since(p.sent) > IdempotenceKeyLifetime {
+			delete(b.processing, key)
+		}
+	}
+}
+
+//paymentRefunds возвращает возвраты платежа, созданные начиная с from
+func paymentRefunds(k *Kassa, paymentID string, from time.Time) ([]Refund, error) {
+	var refunds []Refund
+	filter := &RefundListFilter{PaymentID: paymentID, CreatedAt: TimeFilter{Gte: from}, Limit: 100}
+	for {
+		list, processing, err := k.ListRefunds(filter)
+		if err != nil {
+			return nil, err
+		}
+		if processing != nil {
+			return nil, errors.New("yandexkassa: refund list is processing")
+		}
+		refunds = append(refunds, list.Items...)
+		if list.NextCursor == "" {
+			return refunds, nil
+		}
+		filter.Cursor = list.NextCursor
+	}
+}
+
+func (g *RefundGuard) acquire(paymentID string) *refundBalance {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.payments == nil {
+		g.payments = map[string]*refundBalance{}
+	}
+	balance, ok := g.payments[paymentID]
+	if !ok {
+		balance = &refundBalance{pending: map[string]int64{}, processing: map[string]processingRefund{}, created: map[string]bool{}}
+		g.payments[paymentID] = balance
+	}
+	balance.users++
+	return balance
+}
+
+func (g *RefundGuard) release(paymentID string, balance *refundBalance) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	balance.users--
+	if balance.users == 0 && len(balance.pending) == 0 && len(balance.processing) == 0 {
+		delete(g.payments, paymentID)
+	}
+}
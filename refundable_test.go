@@ -0,0 +1,155 @@
+package yandexkassa_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+//paidPayment создает успешный платеж на 10.00 и возвращает Kassa с RefundGuard
+func paidPayment(t *testing.T, srv *kassatest.Server) (*yandexkassa.Kassa, *yandexkassa.Payment) {
+	t.Helper()
+	kassa := srv.Kassa()
+	kassa.RefundGuard = &yandexkassa.RefundGuard{}
+	payment, _, err := kassa.WithIdempotenceKey("order-1").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{},
+		Capture:           true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	return kassa, payment
+}
+
+func TestRefundGuardConcurrent(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa, payment := paidPayment(t, srv)
+
+	const n = 10
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = kassa.WithIdempotenceKey(fmt.Sprint("refund-", i)).CreateRefund(yandexkassa.RefundRequest{
+				PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "3.00", Currency: "RUB"}})
+		}(i)
+	}
+	wg.Wait()
+
+	var created, rejected int
+	for _, err := range errs {
+		switch err {
+		case nil:
+			created++
+		case yandexkassa.ErrRefundExceedsBalance:
+			rejected++
+		default:
+			t.Fatalf("refund reached the API: %v", err)
+		}
+	}
+	if created != 3 || rejected != n-3 {
+		t.Fatalf("created %d refunds and rejected %d, want 3 and %d", created, rejected, n-3)
+	}
+}
+
+//postCounter считает запросы на создание возвратов
+type postCounter struct {
+	mu    sync.Mutex
+	posts []string //Ключи идемпотентности отправленных запросов
+}
+
+func (c *postCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/refunds") {
+		c.mu.Lock()
+		c.posts = append(c.posts, req.Header.Get("Idempotence-Key"))
+		c.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (c *postCounter) Posts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.posts...)
+}
+
+func TestRefundGuardTracksProcessing(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa, payment := paidPayment(t, srv)
+	counter := &postCounter{}
+	kassa.HTTPClient = &http.Client{Transport: counter}
+
+	srv.Inject(kassatest.Fault{Method: http.MethodPost, Path: "/refunds", StatusCode: http.StatusAccepted})
+	refund, processing, err := kassa.WithIdempotenceKey("refund-1").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "8.00", Currency: "RUB"}})
+	if err != nil || processing == nil || refund != nil {
+		t.Fatalf("got %v, %v, %v; want processing", refund, processing, err)
+	}
+	if pending := kassa.RefundGuard.Pending(payment.ID); pending != 800 {
+		t.Fatalf("pending %d, want 800", pending)
+	}
+
+	//Яндекс.Касса еще не создала первый возврат: его сумма остается в учете, и на второй остатка не хватает
+	_, _, err = kassa.WithIdempotenceKey("refund-2").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "5.00", Currency: "RUB"}})
+	if err != yandexkassa.ErrRefundExceedsBalance {
+		t.Fatalf("got %v, want ErrRefundExceedsBalance", err)
+	}
+
+	//Яндекс.Касса закончила обработку первого запроса
+	if _, _, err = srv.Kassa().WithIdempotenceKey("refund-1").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "8.00", Currency: "RUB"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = kassa.WithIdempotenceKey("refund-3").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "2.00", Currency: "RUB"}}); err != nil {
+		t.Fatal(err)
+	}
+	if pending := kassa.RefundGuard.Pending(payment.ID); pending != 0 {
+		t.Fatalf("pending %d after the first refund completed", pending)
+	}
+	if posts := counter.Posts(); !reflect.DeepEqual(posts, []string{"refund-1", "refund-3"}) {
+		t.Fatalf("refunds sent with keys %v, want only the caller's [refund-1 refund-3]", posts)
+	}
+	stored, _ := srv.Payment(payment.ID)
+	if stored.RefundedAmount.Value != "10.00" {
+		t.Fatalf("refunded %s, want 10.00", stored.RefundedAmount.Value)
+	}
+}
+
+func TestRefundGuardCallerRetry(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa, payment := paidPayment(t, srv)
+
+	request := yandexkassa.RefundRequest{PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "8.00", Currency: "RUB"}}
+	srv.Inject(kassatest.Fault{Method: http.MethodPost, Path: "/refunds", StatusCode: http.StatusAccepted})
+	if _, processing, _ := kassa.WithIdempotenceKey("refund-1").CreateRefund(request); processing == nil {
+		t.Fatal("want processing")
+	}
+
+	//Повтор того же запроса с тем же ключом не упирается в собственную сумму
+	refund, _, err := kassa.WithIdempotenceKey("refund-1").CreateRefund(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Status != yandexkassa.RefundStatusSucceeded {
+		t.Fatalf("refund is %s", refund.Status)
+	}
+	if pending := kassa.RefundGuard.Pending(payment.ID); pending != 0 {
+		t.Fatalf("pending %d after the retry", pending)
+	}
+}
@@ -0,0 +1,222 @@
+package yandexkassa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	Реестр магазинов для сервисов, которые работают с несколькими аккаунтами Яндекс.Кассы (например, по одному
+	на юридическое лицо). Клиент магазина выбирается по ключу, который задает приложение (бренд, шлюз и т.п.).
+	Сам реестр — обработчик уведомлений: его можно указать одним URL для всех магазинов, а он передаст уведомление
+	обработчику того магазина, чей ShopID совпадает с recipient.account_id платежа.
+*/
+
+var (
+	ErrUnknownShop = errors.New("yandexkassa: shop is not registered")
+	ErrShopExists  = errors.New("yandexkassa: shop is already registered")
+)
+
+//Магазин в реестре
+type Shop struct {
+	Kassa         *Kassa       //Клиент магазина со своими ShopID и SecretKey
+	Notifications http.Handler //Обработчик уведомлений магазина, например Kassa.PaymentNotification(...). Если не указан, уведомления магазину отклоняются
+}
+
+//Registry хранит магазины по ключам. Нулевое значение готово к использованию, методы можно вызывать из разных горутин
+type Registry struct {
+	Default string //Ключ магазина для уведомлений, получателя которых определить нельзя (сделки, выплаты). Если не указан, такие уведомления отклоняются
+
+	mu       sync.RWMutex
+	shops    map[string]Shop
+	accounts map[string]string //ShopID -> ключ
+}
+
+//Register добавляет магазин под ключом key. Ключ и ShopID должны быть уникальны в реестре.
+//Если у клиента указан Credentials, ShopID берется из него один раз при регистрации.
+//Магазин, который работает только с OAuth-токеном и не знает своего ShopID, не попадает в ByAccount:
+//уведомления ему доставляются через Store (для возвратов) или как магазину Default
+func (r *Registry) Register(key string, shop Shop) error {
+	if shop.Kassa == nil {
+		return fmt.Errorf("yandexkassa: shop %q has no Kassa", key)
+	}
+	credentials, err := shop.Kassa.credentials()
+	if err != nil {
+		return err
+	}
+	var accountID string
+	if credentials.ShopID != 0 {
+		accountID = strconv.FormatInt(credentials.ShopID, 10)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shops == nil {
+		r.shops = map[string]Shop{}
+		r.accounts = map[string]string{}
+	}
+	if _, ok := r.shops[key]; ok {
+		return ErrShopExists
+	}
+	if _, ok := r.accounts[accountID]; ok && accountID != "" {
+		return ErrShopExists
+	}
+	r.shops[key] = shop
+	if accountID != "" {
+		r.accounts[accountID] = key
+	}
+	return nil
+}
+
+//Unregister удаляет магазин из реестра
+func (r *Registry) Unregister(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for accountID, shopKey := range r.accounts {
+		if shopKey == key {
+			delete(r.accounts, accountID)
+		}
+	}
+	delete(r.shops, key)
+}
+
+//Kassa возвращает клиента магазина по ключу или ErrUnknownShop
+func (r *Registry) Kassa(key string) (*Kassa, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	shop, ok := r.shops[key]
+	if !ok {
+		return nil, ErrUnknownShop
+	}
+	return shop.Kassa, nil
+}
+
+//ByAccount возвращает ключ и клиента магазина по идентификатору аккаунта (recipient.account_id) или ErrUnknownShop
+func (r *Registry) ByAccount(accountID string) (string, *Kassa, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.accounts[accountID]
+	if !ok {
+		return "", nil, ErrUnknownShop
+	}
+	return key, r.shops[key].Kassa, nil
+}
+
+//Keys возвращает ключи магазинов в алфавитном порядке
+func (r *Registry) Keys() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]string, 0, len(r.shops))
+	for key := range r.shops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//ServeHTTP передает уведомление обработчику магазина-получателя. Магазин определяется по recipient.account_id платежа,
+//для возвратов — по платежу в Store магазинов, иначе используется Default. На тело, которое не удалось разобрать,
+//реестр отвечает 400. Если магазин не найден или у него нет обработчика — 404, и Яндекс.Касса повторит уведомление позже
+func (r *Registry) ServeHTTP(w http.ResponseWriter, q *http.Request) {
+	body, err := ioutil.ReadAll(q.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	target, err := decodeRouting(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := r.route(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	r.mu.RLock()
+	shop := r.shops[key]
+	r.mu.RUnlock()
+	if shop.Notifications == nil {
+		http.Error(w, fmt.Sprintf("yandexkassa: shop %q has no notification handler", key), http.StatusNotFound)
+		return
+	}
+
+	q.Body = ioutil.NopCloser(bytes.NewReader(body))
+	shop.Notifications.ServeHTTP(w, q)
+}
+
+//Данные уведомления, по которым выбирается магазин
+type routing struct {
+	event     string //Событие уведомления
+	accountID string //recipient.account_id объекта
+	paymentID string //payment_id возврата
+}
+
+//decodeRouting разбирает тело уведомления (или платеж без обертки)
+func decodeRouting(body []byte) (routing, error) {
+	var object struct {
+		Recipient Recipient `json:"recipient"`
+		PaymentID string    `json:"payment_id"`
+	}
+	var notification Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return routing{}, err
+	}
+	data := body
+	if notification.Type == NotificationType {
+		data = notification.Object
+	}
+	if !isEmptyJSON(data) {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return routing{}, err
+		}
+	}
+	return routing{event: notification.Event, accountID: object.Recipient.AccountID, paymentID: object.PaymentID}, nil
+}
+
+//route возвращает ключ магазина, которому адресовано уведомление
+func (r *Registry) route(target routing) (string, error) {
+	if target.accountID != "" {
+		key, _, err := r.ByAccount(target.accountID)
+		if err != nil {
+			return "", fmt.Errorf("yandexkassa: shop for account %s is not registered", target.accountID)
+		}
+		return key, nil
+	}
+	if strings.HasPrefix(target.event, "refund.") && target.paymentID != "" {
+		if key, ok := r.storedPayment(target.paymentID); ok {
+			return key, nil
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.shops[r.Default]; !ok {
+		return "", fmt.Errorf("yandexkassa: cannot route notification %s to a shop", target.event)
+	}
+	return r.Default, nil
+}
+
+//storedPayment ищет платеж в Store магазинов и возвращает ключ магазина, в хранилище которого он есть
+func (r *Registry) storedPayment(paymentID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for key, shop := range r.shops {
+		if shop.Kassa.Store == nil {
+			continue
+		}
+		if _, err := shop.Kassa.Store.Payment(paymentID); err == nil {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package yandexkassa_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+)
+
+func TestRegistryOAuthOnlyShops(t *testing.T) {
+	var registry yandexkassa.Registry
+	if err := registry.Register("a", yandexkassa.Shop{Kassa: &yandexkassa.Kassa{OAuthToken: "token-a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("b", yandexkassa.Shop{Kassa: &yandexkassa.Kassa{OAuthToken: "token-b"}}); err != nil {
+		t.Fatalf("second OAuth-only shop: %v", err)
+	}
+	if _, _, err := registry.ByAccount("0"); err != yandexkassa.ErrUnknownShop {
+		t.Fatalf("got %v, want ErrUnknownShop for account 0", err)
+	}
+
+	if err := registry.Register("c", yandexkassa.Shop{Kassa: &yandexkassa.Kassa{ShopID: 1, SecretKey: "key"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("d", yandexkassa.Shop{Kassa: &yandexkassa.Kassa{ShopID: 1, SecretKey: "other"}}); err != yandexkassa.ErrShopExists {
+		t.Fatalf("got %v, want ErrShopExists for a duplicate ShopID", err)
+	}
+	if key, _, err := registry.ByAccount("1"); err != nil || key != "c" {
+		t.Fatalf("got %q, %v", key, err)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	var (
+		registry yandexkassa.Registry
+		received []string
+	)
+	handler := func(key string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+			body, _ := ioutil.ReadAll(q.Body)
+			received = append(received, key+" "+string(body))
+		})
+	}
+	store := yandexkassa.NewMemoryStore()
+	if err := store.SavePayment(&yandexkassa.Payment{ID: "p-oauth", Status: yandexkassa.PaymentStatusSucceeded,
+		Amount: yandexkassa.Amount{Value: "1.00", Currency: "RUB"}}); err != nil {
+		t.Fatal(err)
+	}
+	shops := map[string]yandexkassa.Shop{
+		"retail":    {Kassa: &yandexkassa.Kassa{ShopID: 100500, SecretKey: "key"}, Notifications: handler("retail")},
+		"wholesale": {Kassa: &yandexkassa.Kassa{ShopID: 100600, SecretKey: "key"}, Notifications: handler("wholesale")},
+		"partner":   {Kassa: &yandexkassa.Kassa{OAuthToken: "token", Store: store}, Notifications: handler("partner")},
+		"silent":    {Kassa: &yandexkassa.Kassa{ShopID: 100700, SecretKey: "key"}},
+	}
+	for key, shop := range shops {
+		if err := registry.Register(key, shop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		code  int
+		shop  string //Магазин, обработчик которого должен получить уведомление
+		deflt string //Registry.Default
+	}{
+		{"by account", `{"type":"notification","event":"payment.succeeded","object":{"id":"p-1","recipient":{"account_id":"100600","gateway_id":"1"}}}`,
+			http.StatusOK, "wholesale", ""},
+		{"payment without wrapper", `{"id":"p-2","recipient":{"account_id":"100500"}}`, http.StatusOK, "retail", ""},
+		{"refund via store", `{"type":"notification","event":"refund.succeeded","object":{"id":"r-1","payment_id":"p-oauth"}}`,
+			http.StatusOK, "partner", "retail"},
+		{"refund of an unknown payment", `{"type":"notification","event":"refund.succeeded","object":{"id":"r-2","payment_id":"p-other"}}`,
+			http.StatusOK, "retail", "retail"},
+		{"default", `{"type":"notification","event":"deal.closed","object":{"id":"dl-1","status":"closed"}}`,
+			http.StatusOK, "wholesale", "wholesale"},
+		{"no default", `{"type":"notification","event":"deal.closed","object":{"id":"dl-1","status":"closed"}}`,
+			http.StatusNotFound, "", ""},
+		{"unknown account", `{"type":"notification","event":"payment.succeeded","object":{"id":"p-3","recipient":{"account_id":"1"}}}`,
+			http.StatusNotFound, "", "retail"},
+		{"no handler", `{"type":"notification","event":"payment.succeeded","object":{"id":"p-4","recipient":{"account_id":"100700"}}}`,
+			http.StatusNotFound, "", ""},
+		{"malformed", `{"type":"notification","event":`, http.StatusBadRequest, "", "retail"},
+		{"malformed object", `{"type":"notification","event":"payment.succeeded","object":{"recipient":"100500"}}`,
+			http.StatusBadRequest, "", "retail"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received = nil
+			registry.Default = test.deflt
+			recorder := httptest.NewRecorder()
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+			if recorder.Code != test.code {
+				t.Fatalf("got %d (%s), want %d", recorder.Code, strings.TrimSpace(recorder.Body.String()), test.code)
+			}
+			var want []string
+			if test.shop != "" {
+				want = []string{test.shop + " " + test.body}
+			}
+			if strings.Join(received, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("delivered %q, want %q", received, want)
+			}
+		})
+	}
+}
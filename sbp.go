@@ -0,0 +1,67 @@
+package yandexkassa
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+	Оплата через СБП (Систему быстрых платежей). Платеж создается с SbpData и подтверждением qr: пользователь сканирует
+	QR-код в приложении своего банка, а содержимое кода (ссылку qr.nspk.ru) возвращает Payment.QRData — его нужно
+	отрисовать на странице или на экране кассы. Возврат такого платежа приходит на счет пользователя через СБП.
+*/
+
+var (
+	ErrNoQRCode     = errors.New("yandexkassa: payment has no qr confirmation")
+	ErrNotSbpMethod = errors.New("yandexkassa: payment was not paid via SBP")
+)
+
+//Тип способа возврата (поле type в RefundMethod) для возвратов через СБП
+const RefundMethodSbp = PaymentMethodSbp
+
+//Способ, которым деньги возвращены пользователю
+type RefundMethod struct {
+	Type           string `json:"type"`                       //Тип способа возврата, например sbp
+	SbpOperationID string `json:"sbp_operation_id,omitempty"` //Идентификатор операции возврата в СБП
+}
+
+//NewSbpPaymentRequest создает запрос на платеж через СБП с подтверждением по QR-коду. Платеж подтверждается автоматически
+func NewSbpPaymentRequest(amount Amount, description string) *PaymentRequest {
+	return &PaymentRequest{
+		Amount:            amount,
+		Description:       description,
+		PaymentMethodData: SbpData{},
+		Confirmation:      Confirmation{Type: ConfirmationQR},
+		Capture:           true,
+	}
+}
+
+//QRData возвращает содержимое QR-кода, который пользователь должен отсканировать для оплаты.
+//Код есть только у платежа в статусе pending с подтверждением qr
+func (p *Payment) QRData() (string, error) {
+	if p.Status != PaymentStatusPending || p.Confirmation.Type != ConfirmationQR || p.Confirmation.ConfirmationData == "" {
+		return "", ErrNoQRCode
+	}
+	return p.Confirmation.ConfirmationData, nil
+}
+
+//CreateSbpRefund возвращает деньги за платеж, оплаченный через СБП. Если Amount в inputRefund не указан,
+//возвращается весь остаток платежа (RefundableAmount). PaymentID берется из payment
+func (k *Kassa) CreateSbpRefund(payment *Payment, inputRefund RefundRequest) (*Refund, *Processing, error) {
+	if payment.PaymentMethod == nil || payment.PaymentMethod.Type() != PaymentMethodSbp {
+		return nil, nil, ErrNotSbpMethod
+	}
+	if payment.Status != PaymentStatusSucceeded {
+		return nil, nil, fmt.Errorf("yandexkassa: payment %s is in status %s and can't be refunded", payment.ID, payment.Status)
+	}
+
+	inputRefund.PaymentID = payment.ID
+	if inputRefund.Amount.Value == "" {
+		refundable, err := RefundableAmount(payment)
+		if err != nil {
+			return nil, nil, err
+		}
+		inputRefund.Amount = refundable
+	}
+	return k.CreateRefund(inputRefund)
+}
@@ -0,0 +1,322 @@
+package yandexkassa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	Хранилище снимков платежей и возвратов. Если у Kassa указан Store, в него автоматически сохраняются
+	объекты из ответов API (создание, получение, подтверждение, отмена, списки) и из уведомлений PaymentNotification
+	о платежах и возвратах. Уведомления могут прийти не по порядку, поэтому снимок не заменяется снимком с более ранним статусом.
+	Ошибка хранилища не отменяет успешный запрос к API: она передается в Kassa.OnStoreError, а обработчик уведомлений
+	отвечает на нее 500, чтобы Яндекс.Касса повторила уведомление.
+*/
+
+var ErrNotStored = errors.New("yandexkassa: object not found in store")
+
+//Хранилище снимков. Save-методы не должны заменять снимок более старым (см. PaymentReplaces и RefundReplaces)
+type Store interface {
+	SavePayment(payment *Payment) error                      //Добавляет или заменяет снимок платежа
+	Payment(paymentID string) (*Payment, error)              //Возвращает платеж или ErrNotStored
+	PaymentsByMetadata(key, value string) ([]Payment, error) //Платежи, у которых в Metadata по ключу key записано value (например, номер заказа). Значения сравниваются как строки, см. MetadataString
+	PaymentsByStatus(status string) ([]Payment, error)       //Платежи в статусе status
+	PaymentsCreated(from, to time.Time) ([]Payment, error)   //Платежи, созданные в промежутке [from, to), в любом статусе
+	SaveRefund(refund *Refund) error                         //Добавляет или заменяет снимок возврата
+	Refund(refundID string) (*Refund, error)                 //Возвращает возврат или ErrNotStored
+	RefundsByPayment(paymentID string) ([]Refund, error)     //Возвраты платежа
+	RefundsByStatus(status string) ([]Refund, error)         //Возвраты в статусе status
+	RefundsCreated(from, to time.Time) ([]Refund, error)     //Возвраты, созданные в промежутке [from, to), в любом статусе
+}
+
+func (k *Kassa) savePayment(payment *Payment) error {
+	if k.Store == nil {
+		return nil
+	}
+	return k.Store.SavePayment(payment)
+}
+
+func (k *Kassa) saveRefund(refund *Refund) error {
+	if k.Store == nil {
+		return nil
+	}
+	return k.Store.SaveRefund(refund)
+}
+
+//keepPayment сохраняет платеж из успешного ответа API. Ошибка хранилища передается в OnStoreError, а не вызывающему
+func (k *Kassa) keepPayment(payment *Payment) {
+	k.storeError(k.savePayment(payment))
+}
+
+//keepRefund сохраняет возврат из успешного ответа API. Ошибка хранилища передается в OnStoreError, а не вызывающему
+func (k *Kassa) keepRefund(refund *Refund) {
+	k.storeError(k.saveRefund(refund))
+}
+
+func (k *Kassa) storeError(err error) {
+	if err != nil && k.OnStoreError != nil {
+		k.OnStoreError(err)
+	}
+}
+
+//PaymentReplaces сообщает, может ли снимок платежа next заменить сохраненный снимок stored.
+//Статус не возвращается назад (pending → waiting_for_capture → succeeded или canceled), а итоговый статус не меняется на другой.
+//В том же статусе снимок заменяется, только если RefundedAmount в нем не меньше: снимок с меньшей суммой возвратов —
+//запоздавший ответ или уведомление
+func PaymentReplaces(stored, next *Payment) bool {
+	if stored.Status != next.Status {
+		return paymentStatusRank(next.Status) > paymentStatusRank(stored.Status)
+	}
+	return refundedUnits(next) >= refundedUnits(stored)
+}
+
+func paymentStatusRank(status string) int {
+	switch status {
+	case PaymentStatusPending:
+		return 0
+	case PaymentStatusWaitingForCapture:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func refundedUnits(payment *Payment) int64 {
+	if payment.RefundedAmount.Value == "" {
+		return 0
+	}
+	units, _ := payment.RefundedAmount.MinorUnits()
+	return units
+}
+
+//RefundReplaces сообщает, может ли снимок возврата next заменить сохраненный снимок stored: только pending меняется
+//на итоговый статус (succeeded или canceled). В том же статусе остается сохраненный снимок
+func RefundReplaces(stored, next *Refund) bool {
+	return refundStatusRank(next.Status) > refundStatusRank(stored.Status)
+}
+
+func refundStatusRank(status string) int {
+	if status == RefundStatusPending {
+		return 0
+	}
+	return 1
+}
+
+//MetadataString приводит значение из Metadata к строке, с которой сравнивает PaymentsByMetadata. Яндекс.Касса хранит
+//metadata строками, но в платежах из запросов и старых снимков могут оказаться числа и другие значения JSON
+func MetadataString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+//Хранилище в памяти процесса. Списки возвращаются в порядке времени создания
+type MemoryStore struct {
+	mu       sync.RWMutex
+	payments map[string]Payment
+	refunds  map[string]Refund
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{payments: map[string]Payment{}, refunds: map[string]Refund{}}
+}
+
+func (s *MemoryStore) SavePayment(payment *Payment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.payments[payment.ID]; ok && !PaymentReplaces(&stored, payment) {
+		return nil
+	}
+	s.payments[payment.ID] = *payment
+	return nil
+}
+
+func (s *MemoryStore) Payment(paymentID string) (*Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		return nil, ErrNotStored
+	}
+	return &payment, nil
+}
+
+func (s *MemoryStore) PaymentsByMetadata(key, value string) ([]Payment, error) {
+	return s.filterPayments(func(p *Payment) bool {
+		v, ok := p.Metadata[key]
+		return ok && MetadataString(v) == value
+	}), nil
+}
+
+func (s *MemoryStore) PaymentsByStatus(status string) ([]Payment, error) {
+	return s.filterPayments(func(p *Payment) bool {
+		return p.Status == status
+	}), nil
+}
+
+func (s *MemoryStore) PaymentsCreated(from, to time.Time) ([]Payment, error) {
+	return s.filterPayments(func(p *Payment) bool {
+		return createdBetween(p.CreatedAt, from, to)
+	}), nil
+}
+
+func (s *MemoryStore) SaveRefund(refund *Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.refunds[refund.ID]; ok && !RefundReplaces(&stored, refund) {
+		return nil
+	}
+	s.refunds[refund.ID] = *refund
+	return nil
+}
+
+func (s *MemoryStore) Refund(refundID string) (*Refund, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	refund, ok := s.refunds[refundID]
+	if !ok {
+		return nil, ErrNotStored
+	}
+	return &refund, nil
+}
+
+func (s *MemoryStore) RefundsByPayment(paymentID string) ([]Refund, error) {
+	return s.filterRefunds(func(r *Refund) bool {
+		return r.PaymentID == paymentID
+	}), nil
+}
+
+func (s *MemoryStore) RefundsByStatus(status string) ([]Refund, error) {
+	return s.filterRefunds(func(r *Refund) bool {
+		return r.Status == status
+	}), nil
+}
+
+func (s *MemoryStore) RefundsCreated(from, to time.Time) ([]Refund, error) {
+	return s.filterRefunds(func(r *Refund) bool {
+		return createdBetween(r.CreatedAt, from, to)
+	}), nil
+}
+
+func (s *MemoryStore) filterPayments(match func(*Payment) bool) []Payment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var payments []Payment
+	for _, payment := range s.payments {
+		if match(&payment) {
+			payments = append(payments, payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].CreatedAt < payments[j].CreatedAt
+	})
+	return payments
+}
+
+func (s *MemoryStore) filterRefunds(match func(*Refund) bool) []Refund {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var refunds []Refund
+	for _, refund := range s.refunds {
+		if match(&refund) {
+			refunds = append(refunds, refund)
+		}
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt < refunds[j].CreatedAt
+	})
+	return refunds
+}
+
+//Хранилище в JSON-файле. Данные держатся в памяти и целиком перезаписываются в файл при каждом изменении,
+//поэтому оно подходит для небольших объемов (утилиты, тестовые стенды, небольшие магазины)
+type FileStore struct {
+	*MemoryStore
+	path string
+	file sync.Mutex
+}
+
+type fileStoreData struct {
+	Payments []Payment `json:"payments"`
+	Refunds  []Refund  `json:"refunds"`
+}
+
+//OpenFileStore открывает хранилище в файле path. Если файла нет, он будет создан при первом сохранении
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored fileStoreData
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for i := range stored.Payments {
+		s.MemoryStore.SavePayment(&stored.Payments[i])
+	}
+	for i := range stored.Refunds {
+		s.MemoryStore.SaveRefund(&stored.Refunds[i])
+	}
+	return s, nil
+}
+
+func (s *FileStore) SavePayment(payment *Payment) error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.MemoryStore.SavePayment(payment)
+	return s.flush()
+}
+
+func (s *FileStore) SaveRefund(refund *Refund) error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.MemoryStore.SaveRefund(refund)
+	return s.flush()
+}
+
+//flush записывает данные во временный файл и переименовывает его, чтобы файл не оказался записанным наполовину
+func (s *FileStore) flush() error {
+	stored := fileStoreData{
+		Payments: s.filterPayments(func(*Payment) bool { return true }),
+		Refunds:  s.filterRefunds(func(*Refund) bool { return true })}
+	data, err := json.MarshalIndent(&stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
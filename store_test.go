@@ -0,0 +1,154 @@
+package yandexkassa_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+var errBrokenStore = errors.New("broken store")
+
+//brokenStore не сохраняет ничего
+type brokenStore struct {
+	*yandexkassa.MemoryStore
+}
+
+func (brokenStore) SavePayment(*yandexkassa.Payment) error { return errBrokenStore }
+func (brokenStore) SaveRefund(*yandexkassa.Refund) error   { return errBrokenStore }
+
+func noop(*yandexkassa.Kassa, *yandexkassa.Payment) error { return nil }
+
+func TestStoreKeepsLaterStatus(t *testing.T) {
+	store := yandexkassa.NewMemoryStore()
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusSucceeded})
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusWaitingForCapture})
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusCanceled})
+	payment, err := store.Payment("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != yandexkassa.PaymentStatusSucceeded {
+		t.Fatalf("payment moved back to %s", payment.Status)
+	}
+
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusSucceeded,
+		RefundedAmount: yandexkassa.Amount{Value: "1.00", Currency: "RUB"}})
+	if payment, _ = store.Payment("p1"); payment.RefundedAmount.Value != "1.00" {
+		t.Fatal("snapshot with the same status was not saved")
+	}
+
+	//Запоздавшее уведомление payment.succeeded без возвратов не затирает сумму возвратов
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusSucceeded})
+	if payment, _ = store.Payment("p1"); payment.RefundedAmount.Value != "1.00" {
+		t.Fatalf("stale snapshot replaced refunded amount with %q", payment.RefundedAmount.Value)
+	}
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Status: yandexkassa.PaymentStatusSucceeded,
+		RefundedAmount: yandexkassa.Amount{Value: "0.50", Currency: "RUB"}})
+	if payment, _ = store.Payment("p1"); payment.RefundedAmount.Value != "1.00" {
+		t.Fatalf("stale snapshot replaced refunded amount with %q", payment.RefundedAmount.Value)
+	}
+
+	store.SaveRefund(&yandexkassa.Refund{ID: "r1", Status: yandexkassa.RefundStatusSucceeded, Description: "first"})
+	store.SaveRefund(&yandexkassa.Refund{ID: "r1", Status: yandexkassa.RefundStatusSucceeded, Description: "late"})
+	if refund, _ := store.Refund("r1"); refund.Description != "first" {
+		t.Fatal("refund snapshot with the same status replaced the stored one")
+	}
+	store.SaveRefund(&yandexkassa.Refund{ID: "r2", Status: yandexkassa.RefundStatusPending})
+	store.SaveRefund(&yandexkassa.Refund{ID: "r2", Status: yandexkassa.RefundStatusCanceled})
+	if refund, _ := store.Refund("r2"); refund.Status != yandexkassa.RefundStatusCanceled {
+		t.Fatalf("pending refund was not replaced by %s", refund.Status)
+	}
+	store.SaveRefund(&yandexkassa.Refund{ID: "r1", Status: yandexkassa.RefundStatusSucceeded})
+	store.SaveRefund(&yandexkassa.Refund{ID: "r1", Status: yandexkassa.RefundStatusPending})
+	if refund, _ := store.Refund("r1"); refund.Status != yandexkassa.RefundStatusSucceeded {
+		t.Fatalf("refund moved back to %s", refund.Status)
+	}
+}
+
+func TestPaymentsByMetadataNormalizes(t *testing.T) {
+	store := yandexkassa.NewMemoryStore()
+	store.SavePayment(&yandexkassa.Payment{ID: "p1", Metadata: map[string]interface{}{"order_id": float64(42)}})
+	store.SavePayment(&yandexkassa.Payment{ID: "p2", Metadata: map[string]interface{}{"order_id": "42"}})
+	store.SavePayment(&yandexkassa.Payment{ID: "p3", Metadata: map[string]interface{}{"order_id": "43"}})
+
+	payments, err := store.PaymentsByMetadata("order_id", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 {
+		t.Fatalf("got %d payments, want 2", len(payments))
+	}
+}
+
+func TestStoreErrorDoesNotFailRequest(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+	kassa.Store = brokenStore{yandexkassa.NewMemoryStore()}
+	var storeErrs []error
+	kassa.OnStoreError = func(err error) { storeErrs = append(storeErrs, err) }
+
+	payment, _, err := kassa.WithIdempotenceKey("order-1").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}})
+	if err != nil || payment == nil {
+		t.Fatalf("got %v, %v; want the payment without an error", payment, err)
+	}
+	if len(storeErrs) != 1 || storeErrs[0] != errBrokenStore {
+		t.Fatalf("OnStoreError got %v", storeErrs)
+	}
+
+	handler := kassa.PaymentNotification(noop, noop)
+	body := `{"type":"notification","event":"payment.waiting_for_capture","object":{"id":"p1","status":"waiting_for_capture"}}`
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("webhook returned %d, want 500", w.Code)
+	}
+}
+
+func TestPaymentNotificationSavesRefunds(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+	store := yandexkassa.NewMemoryStore()
+	hook := httptest.NewServer((&yandexkassa.Kassa{Store: store}).PaymentNotification(noop, noop))
+	defer hook.Close()
+	srv.WebhookURL = hook.URL
+
+	payment, _, err := kassa.WithIdempotenceKey("order-1").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{},
+		Capture:           true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	refund, _, err := kassa.WithIdempotenceKey("refund-1").CreateRefund(yandexkassa.RefundRequest{
+		PaymentID: payment.ID, Amount: yandexkassa.Amount{Value: "4.00", Currency: "RUB"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Flush()
+	if errs := srv.WebhookErrors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	stored, err := store.Refund(refund.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != yandexkassa.RefundStatusSucceeded {
+		t.Fatalf("stored refund is %s", stored.Status)
+	}
+	if storedPayment, err := store.Payment(payment.ID); err != nil || storedPayment.Status != yandexkassa.PaymentStatusSucceeded {
+		t.Fatalf("stored payment %v, %v", storedPayment, err)
+	}
+}
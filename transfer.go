@@ -0,0 +1,115 @@
+package yandexkassa
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+	Сплитование платежей для маркетплейсов. Платеж пользователя распределяется между магазинами-продавцами (transfers),
+	а возврат можно провести из средств конкретных продавцов (sources). Сумма распределения должна совпадать с суммой платежа
+	или возврата — это проверяется до отправки запроса.
+*/
+
+//Статусы распределения денег магазину (поле status в Transfer). Меняются вместе со статусом платежа
+const (
+	TransferStatusPending           = "pending"
+	TransferStatusWaitingForCapture = "waiting_for_capture"
+	TransferStatusSucceeded         = "succeeded"
+	TransferStatusCanceled          = "canceled"
+)
+
+var ErrTransfersAmountMismatch = errors.New("yandexkassa: transfers total differs from the payment amount")
+var ErrSourcesAmountMismatch = errors.New("yandexkassa: refund sources total differs from the refund amount")
+
+type Transfer struct {
+	AccountID         string                 `json:"account_id"`                    //Идентификатор магазина-продавца, которому переводятся деньги
+	Amount            Amount                 `json:"amount"`                        //Сумма, которую получает магазин
+	PlatformFeeAmount *Amount                `json:"platform_fee_amount,omitempty"` //Комиссия площадки, которая удерживается из Amount
+	Description       string                 `json:"description,omitempty"`         //Описание перевода, до 128 символов
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`            //Дополнительные данные перевода
+	Status            string                 `json:"status,omitempty"`              //Статус распределения. Присутствует только в ответе (Payment)
+}
+
+type RefundSource struct {
+	AccountID         string  `json:"account_id"`                    //Идентификатор магазина-продавца, из средств которого делается возврат
+	Amount            Amount  `json:"amount"`                        //Сумма, которая возвращается из средств магазина
+	PlatformFeeAmount *Amount `json:"platform_fee_amount,omitempty"` //Комиссия площадки, которая возвращается пользователю
+}
+
+//ValidateTransfers проверяет, что переводы в валюте amount, комиссия площадки не больше суммы перевода,
+//а сумма переводов равна amount. Пустой список считается корректным
+func ValidateTransfers(amount Amount, transfers []Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	var total int64
+	for i, transfer := range transfers {
+		if transfer.AccountID == "" {
+			return fmt.Errorf("yandexkassa: transfer %d: account_id is required", i)
+		}
+		value, err := splitAmount(amount, transfer.Amount, transfer.PlatformFeeAmount)
+		if err != nil {
+			return fmt.Errorf("yandexkassa: transfer %d: %v", i, err)
+		}
+		total += value
+	}
+	return checkSplitTotal(amount, total, ErrTransfersAmountMismatch)
+}
+
+//ValidateRefundSources проверяет источники возврата так же, как ValidateTransfers проверяет переводы
+func ValidateRefundSources(amount Amount, sources []RefundSource) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	var total int64
+	for i, source := range sources {
+		if source.AccountID == "" {
+			return fmt.Errorf("yandexkassa: refund source %d: account_id is required", i)
+		}
+		value, err := splitAmount(amount, source.Amount, source.PlatformFeeAmount)
+		if err != nil {
+			return fmt.Errorf("yandexkassa: refund source %d: %v", i, err)
+		}
+		total += value
+	}
+	return checkSplitTotal(amount, total, ErrSourcesAmountMismatch)
+}
+
+//splitAmount проверяет часть платежа и возвращает ее сумму в копейках
+func splitAmount(total, part Amount, fee *Amount) (int64, error) {
+	if part.Currency != total.Currency {
+		return 0, fmt.Errorf("currency %s differs from %s", part.Currency, total.Currency)
+	}
+	value, err := part.MinorUnits()
+	if err != nil {
+		return 0, err
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("amount %s must be positive", part.Value)
+	}
+	if fee != nil {
+		if fee.Currency != total.Currency {
+			return 0, fmt.Errorf("platform fee currency %s differs from %s", fee.Currency, total.Currency)
+		}
+		feeValue, err := fee.MinorUnits()
+		if err != nil {
+			return 0, err
+		}
+		if feeValue < 0 || feeValue > value {
+			return 0, fmt.Errorf("platform fee %s must be between 0 and the amount %s", fee.Value, part.Value)
+		}
+	}
+	return value, nil
+}
+
+func checkSplitTotal(amount Amount, total int64, mismatch error) error {
+	expected, err := amount.MinorUnits()
+	if err != nil {
+		return err
+	}
+	if total != expected {
+		return mismatch
+	}
+	return nil
+}
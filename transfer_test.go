@@ -0,0 +1,172 @@
+package yandexkassa_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func rub(value string) yandexkassa.Amount {
+	return yandexkassa.Amount{Value: value, Currency: "RUB"}
+}
+
+func TestValidateTransfers(t *testing.T) {
+	fee := rub("10.00")
+	tests := []struct {
+		name      string
+		transfers []yandexkassa.Transfer
+		err       string
+	}{
+		{"empty", nil, ""},
+		{"valid", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("600.00"), PlatformFeeAmount: &fee},
+			{AccountID: "456", Amount: rub("400")}}, ""},
+		{"no account", []yandexkassa.Transfer{{Amount: rub("1000.00")}}, "transfer 0: account_id is required"},
+		{"currency", []yandexkassa.Transfer{{AccountID: "123", Amount: yandexkassa.Amount{Value: "1000.00", Currency: "USD"}}},
+			"transfer 0: currency USD differs from RUB"},
+		{"zero amount", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("1000.00")}, {AccountID: "456", Amount: rub("0.00")}},
+			"transfer 1: amount 0.00 must be positive"},
+		{"invalid amount", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("10.001")}}, "transfer 0: yandexkassa: invalid amount"},
+		{"fee exceeds amount", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("5.00"), PlatformFeeAmount: &fee},
+			{AccountID: "456", Amount: rub("995.00")}}, "transfer 0: platform fee 10.00 must be between 0 and the amount 5.00"},
+		{"fee currency", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("1000.00"),
+			PlatformFeeAmount: &yandexkassa.Amount{Value: "1.00", Currency: "USD"}}}, "transfer 0: platform fee currency USD differs from RUB"},
+		{"total", []yandexkassa.Transfer{{AccountID: "123", Amount: rub("600.00")}, {AccountID: "456", Amount: rub("300.00")}},
+			yandexkassa.ErrTransfersAmountMismatch.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := yandexkassa.ValidateTransfers(rub("1000.00"), test.transfers)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("got %v, want no error", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	sources := []yandexkassa.RefundSource{{AccountID: "123", Amount: rub("300.00")}}
+	if err := yandexkassa.ValidateRefundSources(rub("300.00"), sources); err != nil {
+		t.Fatal(err)
+	}
+	if err := yandexkassa.ValidateRefundSources(rub("400.00"), sources); err != yandexkassa.ErrSourcesAmountMismatch {
+		t.Fatalf("got %v, want ErrSourcesAmountMismatch", err)
+	}
+	if err := yandexkassa.ValidateRefundSources(rub("300.00"), []yandexkassa.RefundSource{{Amount: rub("300.00")}}); err == nil {
+		t.Fatal("source without account_id accepted")
+	}
+}
+
+func TestTransfersJSON(t *testing.T) {
+	//Ответы Яндекс.Кассы в формате документации API: платеж с переводами двум продавцам и возврат из средств одного из них
+	samples := []struct {
+		name string
+		json string
+		into interface{}
+	}{
+		{"payment", `{"id":"2a0fa1f3-000f-5000-9000-1cf4cd4cd87b","status":"waiting_for_capture","paid":true,"amount":{"value":"1000.00","currency":"RUB"},"created_at":"2022-04-06T09:15:31.787Z","description":"Заказ №37","metadata":{},"recipient":{"account_id":"100500","gateway_id":"100700"},"refundable":false,"test":false,"transfers":[{"account_id":"123","amount":{"value":"600.00","currency":"RUB"},"platform_fee_amount":{"value":"10.00","currency":"RUB"},"status":"waiting_for_capture"},{"account_id":"456","amount":{"value":"400.00","currency":"RUB"},"platform_fee_amount":{"value":"10.00","currency":"RUB"},"status":"waiting_for_capture"}]}`,
+			&yandexkassa.Payment{}},
+		{"refund", `{"id":"2a0fa2ad-0015-5000-9000-1d2a3b6e9c4f","payment_id":"2a0fa1f3-000f-5000-9000-1cf4cd4cd87b","status":"succeeded","created_at":"2022-04-06T09:18:21.641Z","amount":{"value":"300.00","currency":"RUB"},"sources":[{"account_id":"123","amount":{"value":"300.00","currency":"RUB"},"platform_fee_amount":{"value":"10.00","currency":"RUB"}}]}`,
+			&yandexkassa.Refund{}},
+	}
+	for _, sample := range samples {
+		t.Run(sample.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(sample.json), sample.into); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(sample.into)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again := reflect.New(reflect.TypeOf(sample.into).Elem()).Interface()
+			if err = json.Unmarshal(data, again); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, sample.into) {
+				t.Fatalf("round trip changed the %s:\n%+v\n%+v", sample.name, sample.into, again)
+			}
+		})
+	}
+
+	payment := samples[0].into.(*yandexkassa.Payment)
+	want := yandexkassa.Transfer{AccountID: "456", Amount: rub("400.00"), PlatformFeeAmount: &yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		Status: yandexkassa.TransferStatusWaitingForCapture}
+	if len(payment.Transfers) != 2 || !reflect.DeepEqual(payment.Transfers[1], want) {
+		t.Fatalf("got transfers %+v", payment.Transfers)
+	}
+	refund := samples[1].into.(*yandexkassa.Refund)
+	if len(refund.Sources) != 1 || refund.Sources[0].AccountID != "123" || refund.Sources[0].PlatformFeeAmount.Value != "10.00" {
+		t.Fatalf("got sources %+v", refund.Sources)
+	}
+}
+
+func TestTransfersKassatest(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+
+	fee := rub("10.00")
+	request := &yandexkassa.PaymentRequest{
+		Amount:            rub("1000.00"),
+		PaymentMethodData: yandexkassa.BankCardData{},
+		Transfers:         []yandexkassa.Transfer{{AccountID: "123", Amount: rub("600.00"), PlatformFeeAmount: &fee}, {AccountID: "456", Amount: rub("300.00")}}}
+	if _, _, err := kassa.WithIdempotenceKey("split-1").CreatePayment(request); err != yandexkassa.ErrTransfersAmountMismatch {
+		t.Fatalf("got %v, want ErrTransfersAmountMismatch", err)
+	}
+	if list, _, err := kassa.ListPayments(nil); err != nil || len(list.Items) != 0 {
+		t.Fatalf("payment with invalid transfers reached the API: %v, %v", list, err)
+	}
+
+	request.Transfers[1].Amount = rub("400.00")
+	payment, _, err := kassa.WithIdempotenceKey("split-2").CreatePayment(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payment.Transfers) != 2 || payment.Transfers[0].Status != yandexkassa.TransferStatusPending {
+		t.Fatalf("got transfers %+v", payment.Transfers)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if payment, _, err = kassa.PaymentInfo(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	//Часть товаров не передана: подтверждается 700.00, и переводы должны давать ту же сумму
+	capture := &yandexkassa.CaptureRequest{Amount: &yandexkassa.Amount{Value: "700.00", Currency: "RUB"},
+		Transfers: []yandexkassa.Transfer{{AccountID: "123", Amount: rub("600.00"), PlatformFeeAmount: &fee}}}
+	if _, _, err = kassa.WithIdempotenceKey("split-capture").CapturePayment(payment, capture); err != yandexkassa.ErrTransfersAmountMismatch {
+		t.Fatalf("got %v, want ErrTransfersAmountMismatch", err)
+	}
+	capture.Transfers = append(capture.Transfers, yandexkassa.Transfer{AccountID: "456", Amount: rub("100.00")})
+	captured, _, err := kassa.WithIdempotenceKey("split-capture").CapturePayment(payment, capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, transfer := range captured.Transfers {
+		if transfer.Status != yandexkassa.TransferStatusSucceeded || !reflect.DeepEqual(transfer.Amount, capture.Transfers[i].Amount) {
+			t.Fatalf("transfer %d is %+v after the capture", i, transfer)
+		}
+	}
+	if captured.Transfers[0].PlatformFeeAmount == nil || captured.Transfers[0].PlatformFeeAmount.Value != "10.00" {
+		t.Fatalf("platform fee lost: %+v", captured.Transfers[0])
+	}
+
+	refundRequest := yandexkassa.RefundRequest{PaymentID: payment.ID, Amount: rub("300.00"),
+		Sources: []yandexkassa.RefundSource{{AccountID: "123", Amount: rub("200.00")}}}
+	if _, _, err = kassa.WithIdempotenceKey("split-refund").CreateRefund(refundRequest); err != yandexkassa.ErrSourcesAmountMismatch {
+		t.Fatalf("got %v, want ErrSourcesAmountMismatch", err)
+	}
+	refundRequest.Sources = append(refundRequest.Sources, yandexkassa.RefundSource{AccountID: "456", Amount: rub("100.00")})
+	refund, _, err := kassa.WithIdempotenceKey("split-refund").CreateRefund(refundRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refund.Sources, refundRequest.Sources) {
+		t.Fatalf("got sources %+v, want %+v", refund.Sources, refundRequest.Sources)
+	}
+}
@@ -0,0 +1,116 @@
+package yandexkassa
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+/*
+	Ожидание статуса опросом API для сценариев без уведомлений (утилиты, пакетные задания).
+	Интервал между запросами растет от DefaultPollInterval вдвое до MaxPollInterval,
+	а после ответа 202 запрос повторяется не раньше, чем через Processing.RetryAfter.
+	Временные ошибки (429, 500, сетевые) не прерывают ожидание: запрос повторяется с тем же интервалом.
+	Ожидание заканчивается ошибкой только на остальных ответах API (например, 400 или 404) и когда завершается ctx.
+*/
+
+//Объект перешел в окончательный статус, которого нет среди ожидаемых (например, платеж отменен, а ждали succeeded)
+var ErrFinalStatus = errors.New("yandexkassa: object reached a final status other than expected")
+
+const (
+	DefaultPollInterval = time.Second      //Первая пауза между запросами
+	MaxPollInterval     = 30 * time.Second //Наибольшая пауза между запросами
+)
+
+//WaitForStatus опрашивает PaymentInfo, пока платеж не перейдет в один из статусов statuses или не завершится ctx.
+//Если платеж перешел в succeeded или canceled и этого статуса нет среди statuses, возвращается платеж и ErrFinalStatus
+func (k *Kassa) WaitForStatus(ctx context.Context, paymentID string, statuses ...string) (*Payment, error) {
+	var payment *Payment
+	err := poll(ctx, func() (*Processing, bool, error) {
+		var (
+			processing *Processing
+			err        error
+		)
+		payment, processing, err = k.PaymentInfoContext(ctx, paymentID)
+		if err != nil || processing != nil {
+			return processing, false, err
+		}
+		if hasStatus(payment.Status, statuses) {
+			return nil, true, nil
+		}
+		if payment.Status == PaymentStatusSucceeded || payment.Status == PaymentStatusCanceled {
+			return nil, true, ErrFinalStatus
+		}
+		return nil, false, nil
+	})
+	return payment, err
+}
+
+//WaitForRefundStatus опрашивает RefundInfo, пока возврат не перейдет в один из статусов statuses или не завершится ctx.
+//Если возврат перешел в succeeded или canceled и этого статуса нет среди statuses, возвращается возврат и ErrFinalStatus
+func (k *Kassa) WaitForRefundStatus(ctx context.Context, refundID string, statuses ...string) (*Refund, error) {
+	var refund *Refund
+	err := poll(ctx, func() (*Processing, bool, error) {
+		var (
+			processing *Processing
+			err        error
+		)
+		refund, processing, err = k.RefundInfoContext(ctx, refundID)
+		if err != nil || processing != nil {
+			return processing, false, err
+		}
+		if hasStatus(refund.Status, statuses) {
+			return nil, true, nil
+		}
+		if refund.Status == RefundStatusSucceeded || refund.Status == RefundStatusCanceled {
+			return nil, true, ErrFinalStatus
+		}
+		return nil, false, nil
+	})
+	return refund, err
+}
+
+//poll вызывает check, пока тот не вернет done или ошибку, которая не является временной
+func poll(ctx context.Context, check func() (processing *Processing, done bool, err error)) error {
+	interval := DefaultPollInterval
+	for {
+		processing, done, err := check()
+		if done || (err != nil && !temporaryError(err)) {
+			return err
+		}
+
+		delay := interval
+		if processing != nil {
+			if retry := retryDelay(processing); retry > delay {
+				delay = retry
+			}
+		}
+		if err = sleepContext(ctx, delay); err != nil {
+			return err
+		}
+
+		interval *= 2
+		if interval > MaxPollInterval {
+			interval = MaxPollInterval
+		}
+	}
+}
+
+//temporaryError сообщает, что запрос можно повторить: Яндекс.Касса ответила 429 или 500, либо запрос не дошел из-за сетевой ошибки
+func temporaryError(err error) bool {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.Code == ErrorTooManyRequests || apiErr.Code == ErrorInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func hasStatus(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
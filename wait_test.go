@@ -0,0 +1,62 @@
+package yandexkassa_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func TestWaitRetriesTemporaryErrors(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.Kassa()
+
+	payment, _, err := kassa.WithIdempotenceKey("order-1").CreatePayment(&yandexkassa.PaymentRequest{
+		Amount:            yandexkassa.Amount{Value: "10.00", Currency: "RUB"},
+		PaymentMethodData: yandexkassa.BankCardData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	srv.Inject(kassatest.Fault{Method: http.MethodGet, Path: "/payments", StatusCode: http.StatusTooManyRequests})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	payment, err = kassa.WaitForStatus(ctx, payment.ID, yandexkassa.PaymentStatusWaitingForCapture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != yandexkassa.PaymentStatusWaitingForCapture {
+		t.Fatalf("got %s", payment.Status)
+	}
+}
+
+func TestWaitStopsOnRequestErrors(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := srv.Kassa().WaitForStatus(ctx, "unknown", yandexkassa.PaymentStatusSucceeded)
+	if apiErr, ok := yandexkassa.IsYandexError(err); !ok || apiErr.Code != yandexkassa.ErrorNotFound {
+		t.Fatalf("got %v, want not_found", err)
+	}
+}
+
+func TestWaitRetriesNetworkErrors(t *testing.T) {
+	srv := kassatest.NewServer()
+	kassa := srv.Kassa()
+	srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if _, err := kassa.WaitForRefundStatus(ctx, "r1", yandexkassa.RefundStatusSucceeded); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,123 @@
+package yandexkassa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+/*
+	Управление подписками на уведомления через API партнера. Запросы к /webhooks принимаются только с OAuth-токеном
+	(Kassa.OAuthToken), выданным партнеру для магазина; с ShopID и SecretKey Яндекс.Касса их отклоняет.
+	RegisterWebhooks подходит для утилит развертывания: он создает только недостающие подписки и его можно
+	вызывать при каждом запуске.
+*/
+
+//Для управления уведомлениями нужен OAuth-токен
+var ErrNoOAuthToken = errors.New("yandexkassa: webhooks require OAuthToken")
+
+type WebhookRequest struct {
+	Event string `json:"event"` //Событие, о котором нужно уведомлять, например payment.succeeded
+	URL   string `json:"url"`   //Адрес, на который Яндекс.Касса будет отправлять уведомления (обработчик PaymentNotification)
+}
+
+type Webhook struct {
+	ID    string `json:"id"`    //Идентификатор подписки
+	Event string `json:"event"` //Событие, о котором отправляются уведомления
+	URL   string `json:"url"`   //Адрес, на который отправляются уведомления
+}
+
+type WebhookList struct {
+	Type  string    `json:"type"`  //Формат выдачи результатов запроса (list)
+	Items []Webhook `json:"items"` //Список подписок
+}
+
+func (k *Kassa) CreateWebhook(inputWebhook *WebhookRequest) (*Webhook, *Processing, error) {
+	if err := k.checkOAuthToken(); err != nil {
+		return nil, nil, err
+	}
+	var webhook Webhook
+	processing, err := k.do(http.MethodPost, "/webhooks", inputWebhook, &webhook)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &webhook, nil, nil
+}
+
+func (k *Kassa) ListWebhooks() (*WebhookList, *Processing, error) {
+	if err := k.checkOAuthToken(); err != nil {
+		return nil, nil, err
+	}
+	var list WebhookList
+	processing, err := k.do(http.MethodGet, "/webhooks", nil, &list)
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+	return &list, nil, nil
+}
+
+func (k *Kassa) DeleteWebhook(webhookID string) (*Processing, error) {
+	if err := k.checkOAuthToken(); err != nil {
+		return nil, err
+	}
+	return k.do(http.MethodDelete, "/webhooks/"+url.PathEscape(webhookID), nil, nil)
+}
+
+//RegisterWebhooks подписывает webhookURL на события events и возвращает подписки на них, включая уже существующие.
+//Подписки на события, которые уже отправляются на webhookURL, не создаются повторно. Ключ идемпотентности
+//каждой новой подписки — хеш магазина, события и webhookURL (и IdempotenceKey, если он указан), поэтому после 202
+//вызов можно просто повторить с теми же аргументами, а подписки разных магазинов и адресов не получат один ключ
+func (k *Kassa) RegisterWebhooks(webhookURL string, events ...string) ([]Webhook, *Processing, error) {
+	credentials, err := k.credentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	list, processing, err := k.ListWebhooks()
+	if err != nil || processing != nil {
+		return nil, processing, err
+	}
+
+	var webhooks []Webhook
+	for _, event := range events {
+		found := false
+		for _, webhook := range list.Items {
+			if webhook.Event == event && webhook.URL == webhookURL {
+				webhooks = append(webhooks, webhook)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		key := webhookKey(credentials, k.IdempotenceKey, event, webhookURL)
+		webhook, processing, err := k.WithIdempotenceKey(key).CreateWebhook(&WebhookRequest{Event: event, URL: webhookURL})
+		if err != nil || processing != nil {
+			return webhooks, processing, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, nil, nil
+}
+
+//webhookKey возвращает ключ идемпотентности подписки длиной 40 символов (Яндекс.Касса принимает до 64)
+func webhookKey(credentials *Credentials, salt, event, webhookURL string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%s|%s", credentials.ShopID, credentials.OAuthToken, salt, event, webhookURL)))
+	return "webhook-" + hex.EncodeToString(sum[:16])
+}
+
+//checkOAuthToken проверяет, что запросы авторизуются OAuth-токеном (из поля OAuthToken или из Credentials)
+func (k *Kassa) checkOAuthToken() error {
+	credentials, err := k.credentials()
+	if err != nil {
+		return err
+	}
+	if credentials.OAuthToken == "" {
+		return ErrNoOAuthToken
+	}
+	return nil
+}
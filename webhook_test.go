@@ -0,0 +1,38 @@
+package yandexkassa_test
+
+import (
+	"testing"
+
+	"yandexkassa"
+	"yandexkassa/kassatest"
+)
+
+func TestRegisterWebhooksDistinctKeys(t *testing.T) {
+	srv := kassatest.NewServer()
+	defer srv.Close()
+	kassa := srv.PartnerKassa()
+
+	first, _, err := kassa.RegisterWebhooks("https://example.com/a", yandexkassa.EventPaymentSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Без IdempotenceKey вторая подписка на то же событие, но другой адрес не должна получить ключ первой
+	second, _, err := kassa.RegisterWebhooks("https://example.com/b", yandexkassa.EventPaymentSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || len(second) != 1 || first[0].ID == second[0].ID || second[0].URL != "https://example.com/b" {
+		t.Fatalf("got %+v and %+v", first, second)
+	}
+
+	again, _, err := kassa.RegisterWebhooks("https://example.com/a", yandexkassa.EventPaymentSucceeded, yandexkassa.EventRefundSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 2 || again[0].ID != first[0].ID {
+		t.Fatalf("got %+v", again)
+	}
+	if webhooks := srv.Webhooks(); len(webhooks) != 3 {
+		t.Fatalf("server has %d webhooks, want 3", len(webhooks))
+	}
+}
@@ -1,6 +1,18 @@
 package yandexkassa
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	ErrorInvalidRequest      = "invalid_request"
@@ -18,6 +30,48 @@ type Amount struct {
 	Currency string `json:"currency"` //Код валюты в формате ISO-4217. Должен соответствовать валюте вашего аккаунта
 }
 
+//MinorUnits возвращает сумму в минимальных единицах валюты (копейках, центах), например 10.50 — 1050
+func (a Amount) MinorUnits() (int64, error) {
+	value := strings.TrimSpace(a.Value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	parts := strings.SplitN(value, ".", 2)
+	units, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || parts[0] == "" {
+		return 0, fmt.Errorf("yandexkassa: invalid amount %q", a.Value)
+	}
+	units *= 100
+	if len(parts) == 2 {
+		fraction := parts[1]
+		if len(fraction) == 0 || len(fraction) > 2 {
+			return 0, fmt.Errorf("yandexkassa: invalid amount %q", a.Value)
+		}
+		if len(fraction) == 1 {
+			fraction += "0"
+		}
+		cents, err := strconv.ParseInt(fraction, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("yandexkassa: invalid amount %q", a.Value)
+		}
+		units += cents
+	}
+	if negative {
+		units = -units
+	}
+	return units, nil
+}
+
+//NewAmount создает сумму из минимальных единиц валюты, например NewAmount(1050, "RUB") — 10.50 RUB
+func NewAmount(minorUnits int64, currency string) Amount {
+	sign := ""
+	if minorUnits < 0 {
+		sign = "-"
+		minorUnits = -minorUnits
+	}
+	return Amount{Value: fmt.Sprintf("%s%d.%02d", sign, minorUnits/100, minorUnits%100), Currency: currency}
+}
+
 type Receipt struct {
 	Items         []Item `json:"items"`           //Список товаров в заказе
 	TaxSystemCode int64  `json:"tax_system_code"` //Система налогообложения магазина
@@ -32,10 +86,143 @@ type Item struct {
 	VatCode     int    `json:"vat_code"`    //Ставка НДС. Возможные значения — числа от 1 до 6
 }
 
+//Адрес API Яндекс.Кассы по умолчанию
+const DefaultBaseURL = "https://payment.yandex.net/api/v3"
+
 type Kassa struct {
-	ShopID         int64
-	SecretKey      string
-	IdempotenceKey string
+	ShopID           int64
+	SecretKey        string
+	OAuthToken       string              //OAuth-токен партнера. Если указан, запросы авторизуются им (Bearer) вместо ShopID и SecretKey
+	Credentials      CredentialsProvider //Если указан, данные авторизации берутся из него перед каждым запросом вместо ShopID, SecretKey и OAuthToken
+	IdempotenceKey   string
+	BaseURL          string          //Адрес API. Если не указан, используется DefaultBaseURL. Можно заменить, например, на адрес тестового сервера из пакета kassatest
+	HTTPClient       *http.Client    //HTTP-клиент для запросов к API. Если не указан, используется клиент по умолчанию
+	Store            Store           //Хранилище, в которое сохраняются платежи и возвраты из ответов API и уведомлений. Необязательно
+	OnStoreError     func(err error) //Вызывается, если объект из успешного ответа API не удалось сохранить в Store. Результат запроса возвращается без ошибки
+	RefundGuard      *RefundGuard    //Если указан, CreateRefund проверяет остаток платежа и не отправляет возвраты сверх него. Необязательно
+	OrderMetadataKey string          //Ключ в Metadata с номером заказа, по которому Reconcile сопоставляет платежи. По умолчанию DefaultOrderMetadataKey
+}
+
+//WithIdempotenceKey возвращает копию Kassa с другим ключом идемпотентности, например для повтора конкретного запроса
+func (k *Kassa) WithIdempotenceKey(idempotenceKey string) *Kassa {
+	kassa := *k
+	kassa.IdempotenceKey = idempotenceKey
+	return &kassa
+}
+
+func (k *Kassa) apiURL(path string) string {
+	if k.BaseURL != "" {
+		return strings.TrimRight(k.BaseURL, "/") + path
+	}
+	return DefaultBaseURL + path
+}
+
+func (k *Kassa) httpClient() *http.Client {
+	if k.HTTPClient != nil {
+		return k.HTTPClient
+	}
+	return &http.Client{}
+}
+
+//credentials возвращает данные авторизации из Credentials или из полей ShopID, SecretKey и OAuthToken
+func (k *Kassa) credentials() (*Credentials, error) {
+	if k.Credentials != nil {
+		return k.Credentials.Credentials()
+	}
+	return &Credentials{ShopID: k.ShopID, SecretKey: k.SecretKey, OAuthToken: k.OAuthToken}, nil
+}
+
+//send авторизует запрос и отправляет его. Если Яндекс.Касса отклонила данные авторизации (401), а у них есть Previous,
+//запрос повторяется с предыдущими данными — так смена ключа проходит без ошибок, какой бы из ключей ни действовал в этот момент
+func (k *Kassa) send(req *http.Request) (*http.Response, error) {
+	credentials, err := k.credentials()
+	if err != nil {
+		return nil, err
+	}
+	credentials.apply(req)
+
+	client := k.httpClient()
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || credentials.Previous == nil {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	credentials.Previous.apply(retry)
+	return client.Do(retry)
+}
+
+//do отправляет запрос к API и разбирает ответ 200 в result. Тело request (если оно есть) передается в JSON,
+//а POST-запросы отправляются с ключом идемпотентности. Ответ 202 возвращается как Processing, остальные — как *Error
+func (k *Kassa) do(method, path string, request, result interface{}) (*Processing, error) {
+	return k.doContext(context.Background(), method, path, request, result)
+}
+
+//doContext выполняет запрос так же, как do, но прерывает его при завершении ctx
+func (k *Kassa) doContext(ctx context.Context, method, path string, request, result interface{}) (*Processing, error) {
+	var reqBody io.Reader
+	if request != nil {
+		serialized, err := json.Marshal(request)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(serialized)
+	}
+
+	req, err := http.NewRequest(method, k.apiURL(path), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if method == "POST" {
+		req.Header.Set("Idempotence-Key", k.IdempotenceKey)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+
+	case http.StatusOK:
+		if result == nil {
+			return nil, nil
+		}
+		return nil, json.Unmarshal(body, result)
+
+	case http.StatusAccepted:
+		var proc Processing
+		if err = json.Unmarshal(body, &proc); err != nil {
+			return nil, err
+		}
+		return &proc, nil
+
+	default:
+		var yandexError Error
+		if err = json.Unmarshal(body, &yandexError); err != nil {
+			return nil, err
+		}
+		return nil, &yandexError
+	}
 }
 
 type Error struct {
@@ -57,3 +244,66 @@ func IsYandexError(err error) (*Error, bool) {
 		return err, false
 	}
 }
+
+//Форматы времени, в которых Яндекс.Касса передает даты (ISO 8601, по UTC)
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+//ParseTime разбирает время в формате ISO 8601, например 2017-11-03T11:52:31.827Z. Пустая строка дает нулевое время без ошибки
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("yandexkassa: cannot parse time %q", value)
+}
+
+//FormatTime переводит время в формат, который принимает Яндекс.Касса в фильтрах, например 2017-11-03T11:52:31.827Z
+func FormatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+//Фильтр по полю времени (created_at, captured_at, expires_at) для запросов списков. Нулевые значения не передаются
+type TimeFilter struct {
+	Gte time.Time //Время больше либо равно
+	Gt  time.Time //Время больше
+	Lte time.Time //Время меньше либо равно
+	Lt  time.Time //Время меньше
+}
+
+func (f TimeFilter) encode(values url.Values) {
+	f.encodeAs(values, "created_at")
+}
+
+//encodeAs передает фильтр для поля времени field, например captured_at или expires_at
+func (f TimeFilter) encodeAs(values url.Values, field string) {
+	setTime(values, field+".gte", f.Gte)
+	setTime(values, field+".gt", f.Gt)
+	setTime(values, field+".lte", f.Lte)
+	setTime(values, field+".lt", f.Lt)
+}
+
+func setTime(values url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		values.Set(key, FormatTime(t))
+	}
+}
+
+func setString(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
+
+func setInt(values url.Values, key string, value int) {
+	if value > 0 {
+		values.Set(key, strconv.Itoa(value))
+	}
+}